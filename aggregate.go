@@ -0,0 +1,120 @@
+package rdblite
+
+import (
+	"log"
+	"time"
+)
+
+// Number types that can be aggregated
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 |
+		~float32 | ~float64
+}
+
+// Stats for the aggregated values of a set of rows
+type Stats[N Number] struct {
+	Count int
+	Sum   N
+	Min   N
+	Max   N
+}
+
+// Avg of the values, 0 if there are none
+func (s Stats[N]) Avg() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return float64(s.Sum) / float64(s.Count)
+}
+
+func (s *Stats[N]) add(v N) {
+	if s.Count == 0 || v < s.Min {
+		s.Min = v
+	}
+	if s.Count == 0 || v > s.Max {
+		s.Max = v
+	}
+	s.Sum += v
+	s.Count++
+}
+
+// Count rows matching the predicate, a nil predicate counts all rows
+func (t *Table[T]) Count(predicate func(row T) bool) int {
+	start := time.Now()
+	count := 0
+	t.m.RLock()
+	for _, r := range t.rows {
+		if predicate == nil || predicate(*r) {
+			count++
+		}
+	}
+	t.m.RUnlock()
+	log.Println("count time =", time.Since(start))
+	return count
+}
+
+// Aggregate the selected value of rows matching the predicate, a nil predicate uses all rows
+func Aggregate[T tableInterface, N Number](t *Table[T], predicate func(row T) bool, selector func(row T) N) Stats[N] {
+	start := time.Now()
+	var s Stats[N]
+	t.m.RLock()
+	for _, r := range t.rows {
+		if predicate == nil || predicate(*r) {
+			s.add(selector(*r))
+		}
+	}
+	t.m.RUnlock()
+	log.Println("aggregate time =", time.Since(start))
+	return s
+}
+
+// Sum the selected value of rows matching the predicate
+func Sum[T tableInterface, N Number](t *Table[T], predicate func(row T) bool, selector func(row T) N) N {
+	return Aggregate(t, predicate, selector).Sum
+}
+
+// Min of the selected value of rows matching the predicate, false if no rows match
+func Min[T tableInterface, N Number](t *Table[T], predicate func(row T) bool, selector func(row T) N) (N, bool) {
+	s := Aggregate(t, predicate, selector)
+	return s.Min, s.Count > 0
+}
+
+// Max of the selected value of rows matching the predicate, false if no rows match
+func Max[T tableInterface, N Number](t *Table[T], predicate func(row T) bool, selector func(row T) N) (N, bool) {
+	s := Aggregate(t, predicate, selector)
+	return s.Max, s.Count > 0
+}
+
+// Avg of the selected value of rows matching the predicate, false if no rows match
+func Avg[T tableInterface, N Number](t *Table[T], predicate func(row T) bool, selector func(row T) N) (float64, bool) {
+	s := Aggregate(t, predicate, selector)
+	return s.Avg(), s.Count > 0
+}
+
+// GroupBy buckets rows matching the predicate by key and aggregates the selected value per group
+func GroupBy[T tableInterface, K comparable, N Number](t *Table[T], predicate func(row T) bool, key func(row T) K, selector func(row T) N) map[K]Stats[N] {
+	start := time.Now()
+	groups := make(map[K]*Stats[N])
+	t.m.RLock()
+	for _, r := range t.rows {
+		if predicate != nil && !predicate(*r) {
+			continue
+		}
+		k := key(*r)
+		s, ok := groups[k]
+		if !ok {
+			s = &Stats[N]{}
+			groups[k] = s
+		}
+		s.add(selector(*r))
+	}
+	t.m.RUnlock()
+
+	data := make(map[K]Stats[N], len(groups))
+	for k, s := range groups {
+		data[k] = *s
+	}
+	log.Println("group by time =", time.Since(start))
+	return data
+}
@@ -0,0 +1,46 @@
+package rdblite
+
+import (
+	"testing"
+)
+
+func Test_aggregate(t *testing.T) {
+	createTest()
+	tt := Table[Testdata]{
+		GobFilename: "test/test.gob",
+	}
+	tt.LoadGob()
+
+	// gendata() ages are 11..109
+	age := func(row Testdata) int { return row.Age }
+	if n := tt.Count(nil); n != 99 {
+		t.Error("count expected 99 got", n)
+	}
+	if s := Sum(&tt, nil, age); s != 5940 {
+		t.Error("sum expected 5940 got", s)
+	}
+	if m, ok := Min(&tt, nil, age); !ok || m != 11 {
+		t.Error("min expected 11 got", m)
+	}
+	if m, ok := Max(&tt, nil, age); !ok || m != 109 {
+		t.Error("max expected 109 got", m)
+	}
+	if a, ok := Avg(&tt, nil, age); !ok || a != 60 {
+		t.Error("avg expected 60 got", a)
+	}
+	if _, ok := Max(&tt, func(row Testdata) bool { return false }, age); ok {
+		t.Error("max of no rows should be false")
+	}
+
+	groups := GroupBy(&tt, func(row Testdata) bool {
+		return row.Age <= 20
+	}, func(row Testdata) bool {
+		return row.Age%2 == 0
+	}, func(row Testdata) float64 {
+		return float64(row.Age)
+	})
+	if len(groups) != 2 || groups[true].Count != 5 || groups[false].Sum != 11+13+15+17+19 {
+		t.Error("group by failed", groups)
+	}
+	tt.Close()
+}
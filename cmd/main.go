@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -74,7 +75,9 @@ func main() {
 
 	log.Println("search for :", str)
 	log.Println("search rows count =", len(rows))
-	fmt.Println(rows[0])
+	if len(rows) > 0 {
+		fmt.Println(rows[0])
+	}
 	fmt.Println()
 	fmt.Println("rows =", db.Table1.TotalRows())
 
@@ -96,7 +99,9 @@ func main() {
 	rr := db.Docs.Search(str)
 	log.Println("search for :", str)
 	log.Println("search rows count =", len(rr))
-	log.Println(rr[0])
+	if len(rr) > 0 {
+		log.Println(rr[0])
+	}
 	fmt.Println()
 
 	PrintMemUsage()
@@ -128,11 +133,6 @@ func byteToMegaByte(b uint64) uint64 {
 	return b / 1024 / 1024
 }
 
-func fileExists(fn string) bool {
-	_, e := os.Stat(fn)
-	return e == nil
-}
-
 // -----------------------------------------------------------------------------
 
 type Customers struct {
@@ -163,52 +163,34 @@ type Doc struct {
 }
 
 type DB struct {
-	Table1    *rdblite.Table[Table1]
-	Customers *rdblite.Table[Customers]
-	Docs      *rdblite.Table[Doc]
-}
-
-func (d *DB) Close() {
-	// close all tables
-	d.Table1.Close()
-	d.Customers.Close()
-	d.Docs.Close()
+	*rdblite.Database // Close() saves all tables
+	Table1            *rdblite.Table[Table1]
+	Customers         *rdblite.Table[Customers]
+	Docs              *rdblite.Table[Doc]
 }
 
 func NewDB() *DB {
-
-	db := DB{}
-
-	db.Table1 = &rdblite.Table[Table1]{
-		GobFilename: "data/table1.gob",
-	}
-
-	db.Customers = &rdblite.Table[Customers]{
-		GobFilename: "data/customers.gob",
+	d, e := rdblite.OpenDatabase("data")
+	if e != nil {
+		log.Fatalln(e)
 	}
-
-	db.Docs = &rdblite.Table[Doc]{
-		GobFilename: "data/docs.gob",
+	db := DB{Database: d}
+	if db.Table1, e = rdblite.Register[Table1](d, "table1"); e != nil {
+		log.Fatalln(e)
 	}
-
-	if fileExists(db.Docs.GobFilename) {
-		db.Docs.LoadGob()
-	} else {
-		db.Docs.LoadJson("Archive.json")
+	if db.Customers, e = rdblite.Register[Customers](d, "customers"); e != nil {
+		log.Fatalln(e)
 	}
-	fmt.Println()
-
-	if fileExists(db.Table1.GobFilename) {
-		db.Table1.LoadGob()
-	} else {
-		db.Table1.LoadJson("table1.json")
+	if db.Docs, e = rdblite.Register[Doc](d, "docs"); e != nil {
+		log.Fatalln(e)
 	}
-	fmt.Println()
+	// seed from the json files in the working directory if there is no gob file
+	db.Table1.JsonFilename = "table1.json"
+	db.Customers.JsonFilename = "customers.json"
+	db.Docs.JsonFilename = "Archive.json"
 
-	if fileExists(db.Customers.GobFilename) {
-		db.Customers.LoadGob()
-	} else {
-		db.Customers.LoadJson("customers.json")
+	if e = d.Load(); e != nil {
+		log.Fatalln(e)
 	}
 	fmt.Println()
 
@@ -218,24 +200,36 @@ func NewDB() *DB {
 // sample code for README.md file
 func Readme_md_code() {
 	db := DB{}
+	// single table without a Database
 	db.Table1 = &rdblite.Table[Table1]{
 		GobFilename: "data/table1.gob",
 	}
-	if fileExists(db.Table1.GobFilename) {
-		db.Table1.LoadGob()
-	} else {
-		db.Table1.LoadJson("table1.json")
+	if e := db.Table1.LoadGob(); e != nil {
+		// missing or corrupt gob file so load the json
+		log.Println(e)
+		if e = db.Table1.LoadJson("table1.json"); e != nil {
+			log.Println(e)
+		}
 	}
 	// load from gob file stored in Table1.GobFilename
 	// this is not thread safe
-	db.Table1.LoadGob()
+	err := db.Table1.LoadGob()
+	if err != nil {
+		log.Println(err)
+	}
 
 	// load from a json file
 	// this is not thread safe
-	db.Table1.LoadJson("table1.json")
+	err = db.Table1.LoadJson("table1.json")
+	if err != nil {
+		log.Println(err)
+	}
 
 	// save to gob file stored in Table1.GobFilename
-	db.Table1.SaveGob()
+	err = db.Table1.SaveGob()
+	if err != nil {
+		log.Println(err)
+	}
 
 	// query rows
 	rows := db.Table1.Query(func(row Table1) bool {
@@ -249,19 +243,121 @@ func Readme_md_code() {
 	})
 	fmt.Println(rows)
 
+	// query rows sorted by fields, paging is applied after sorting
+	rows, _ = db.Table1.QueryPagedSorted(10, 5, func(row Table1) bool {
+		return row.ItemCount < 5
+	}, rdblite.Desc("ItemCount"), rdblite.Asc("CustomerName"))
+	fmt.Println(rows)
+
+	// aggregate a field over rows matching a predicate (nil for all rows)
+	total := rdblite.Sum(db.Table1, nil, func(row Table1) int { return row.ItemCount })
+	fmt.Println(total)
+
+	// group by a key and get count, sum, min, max and avg per group
+	groups := rdblite.GroupBy(db.Table1, nil, func(row Table1) string {
+		return row.CustomerName
+	}, func(row Table1) int {
+		return row.ItemCount
+	})
+	fmt.Println(groups["Tomas"].Count, groups["Tomas"].Avg())
+
 	// text search row for "alice" AND "bob" in any of the fields
 	rows = db.Table1.Search("alice bob")
 	fmt.Println(rows)
 
+	// OR, NOT, "exact phrase", grouping and field:term
+	rows = db.Table1.Search(`(alice OR bob) -"bob smith" CustomerName:tomas`)
+	fmt.Println(rows)
+
+	// search ordered by score, best first with the fields and terms that matched
+	// matches in a field count more with SetFieldWeight() or the `rdb:"weight=2"` struct tag
+	db.Table1.SetFieldWeight("CustomerName", 2)
+	for _, res := range db.Table1.SearchRanked("alice bob") {
+		fmt.Println(res.Score, res.Matches, res.Row)
+	}
+
 	// find by ID -> bool, nil if not found
 	ok, row := db.Table1.FindByID(99_999)
 	if ok {
 		fmt.Println(row)
 	}
 
+	// find all rows by a field value, uses an index if the field has one
+	// create indexes with CreateIndex() or tag the field with `rdb:"index"`
+	db.Table1.CreateIndex("CustomerName")
+	rows, _ = db.Table1.FindBy("CustomerName", "Tomas")
+	fmt.Println(rows)
+
+	// range query on a field in field order, uses a sorted index if the field has one
+	// create sorted indexes with CreateSortedIndex() or tag the field with `rdb:"sorted"`
+	db.Table1.CreateSortedIndex("ItemCount")
+	rows, _ = db.Table1.QueryRange("ItemCount", 5, 10)
+	fmt.Println(rows)
+
+	// change a row in place, no race with other writers between reading and writing
+	db.Table1.UpdateFunc(20, func(r *Table1) {
+		r.ItemCount++
+	})
+	// or set fields by name
+	db.Table1.Patch(20, map[string]any{"CustomerName": "bob"})
+
+	// update only if the row was not changed since it was read
+	_, row = db.Table1.FindByID(20)
+	row.ItemCount++
+	if _, err = db.Table1.UpdateIfVersion(row); errors.Is(err, rdblite.ErrConflict) {
+		// read again and retry
+		log.Println(err)
+	}
+
+	// hooks run on every write and can change the row or reject it with an error,
+	// also implement Validate() error or BeforeSave() error on *Table1
+	db.Table1.BeforeWrite(func(r *Table1) error {
+		if r.CustomerName == "" {
+			return errors.New("customer name is empty")
+		}
+		return nil
+	})
+	// AddUpdate() only returns 0 when a row is rejected so use Insert() to get the error
+	if _, err = db.Table1.Insert(Table1{ItemCount: 1}); err != nil {
+		log.Println(err)
+	}
+
+	// row change events, nil filter for all changes and 0 for the default buffer
+	sub := db.Table1.Subscribe(func(e rdblite.Event[Table1]) bool {
+		return e.Type == rdblite.EventDelete
+	}, 0)
+	go func() {
+		for e := range sub.C {
+			log.Println(e.Type, e.ID, e.Old)
+		}
+	}()
+	defer sub.Unsubscribe()
+
+	// join rows to the row in another table with the ID returned by the key function,
+	// here the customer with the same ID, LeftJoinByID() keeps rows without a match
+	for _, p := range rdblite.JoinByID(db.Table1, nil, func(row Table1) int {
+		return row.ID
+	}, db.Customers) {
+		fmt.Println(p.Left.CustomerName, p.Right.Firstname)
+	}
+	// or on a field of the other table, uses the index on the field if it has one
+	pairs, _ := rdblite.LeftJoinOn(db.Customers, nil, func(row Customers) any {
+		return row.Firstname
+	}, db.Table1, "CustomerName")
+	fmt.Println(len(pairs))
+
 	// delete by ID
 	db.Table1.Delete(20)
 
+	// transaction, changes are applied together on Commit() or discarded on Rollback()
+	tx := db.Table1.Begin()
+	newid, _ := tx.AddUpdate(Table1{CustomerName: "bob", ItemCount: 3})
+	tx.Delete(21)
+	ok, row = tx.FindByID(newid) // sees the changes in the transaction
+	if err = tx.Commit(); err != nil {
+		log.Println(err)
+	}
+
 	// row count
 	count := db.Table1.TotalRows()
 	fmt.Println(count)
@@ -272,4 +368,15 @@ func Readme_md_code() {
 		ItemCount:    42,
 	}
 	db.Table1.AddUpdate(r)
+
+	// insert only, an ID > 0 is kept, ErrDuplicateID if it exists
+	if _, err = db.Table1.Insert(r); err != nil {
+		log.Println(err)
+	}
+	// update only, ErrNotFound if the ID does not exist
+	if err = db.Table1.Update(r); err != nil {
+		log.Println(err)
+	}
+	// update or insert
+	db.Table1.Upsert(r)
 }
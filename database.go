@@ -0,0 +1,378 @@
+package rdblite
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mgholam/rdblite/storagefile"
+)
+
+const (
+	journalFilename = "journal.wal"
+)
+
+var ErrNotReplayed = errors.New("database journal not replayed, call Load() before saving")
+
+// Database of tables stored in a data directory as name.gob files,
+// loaded together and saved together by one shared timer
+type Database struct {
+	Dir          string
+	SaveInterval time.Duration // for dirty tables, default SAVE_TIMER seconds
+	WAL          bool          // log all table changes to one journal.wal write ahead log, set before Register()
+	m            sync.Mutex
+	tables       []dbTable // in registration order
+	names        map[string]dbTable
+	journal      *storagefile.StorageFile
+	journalErr   error // the journal could not be reopened, writes fail until it is
+	replayed     bool  // the journal is in the tables so it can be emptied by a save
+	stimer       *time.Ticker
+	done         chan struct{}
+}
+
+// dbTable is a Table[T] in a Database
+type dbTable interface {
+	refTable
+	tableName() string
+	load() error
+	setJournal(wal *storagefile.StorageFile, e error)
+	applyLog(recs []walRecord) error
+	// callers must hold the lock
+	dirty() bool
+	save() error
+	rowCount() int
+	writeGob(filename string, backup bool) error
+	// call without the lock
+	onSave(rows int, start time.Time, e error)
+	shutdown()
+}
+
+// OpenDatabase in dir, the directory is created if needed. Register tables then call Load()
+func OpenDatabase(dir string) (*Database, error) {
+	if e := os.MkdirAll(dir, 0755); e != nil {
+		return nil, e
+	}
+	return &Database{
+		Dir:   dir,
+		names: make(map[string]dbTable),
+	}, nil
+}
+
+// Register a table with a name, stored as name.gob in the database directory.
+// Set JsonFilename before Load() to seed it from another json file.
+// The table is saved by the database so it uses SaveManual
+func Register[T tableInterface](db *Database, name string) (*Table[T], error) {
+	db.m.Lock()
+	defer db.m.Unlock()
+	if _, ok := db.names[name]; ok {
+		return nil, fmt.Errorf("table %s already registered", name)
+	}
+	t := &Table[T]{
+		GobFilename:  filepath.Join(db.Dir, name+".gob"),
+		JsonFilename: filepath.Join(db.Dir, name+".json"),
+		SavePolicy:   SavePolicy{Mode: SaveManual},
+		name:         name,
+	}
+	// locked in registration order
+	t.setSeq()
+	if db.WAL {
+		if db.journal == nil {
+			sf, e := openLog(filepath.Join(db.Dir, journalFilename))
+			if e != nil {
+				return nil, e
+			}
+			db.journal = sf
+		}
+		t.setJournal(db.journal, nil)
+	}
+	db.tables = append(db.tables, t)
+	db.names[name] = t
+	return t, nil
+}
+
+// Load all tables in parallel from name.gob, or JsonFilename if there is no gob file,
+// replay the journal and start the save timer. Tables with duplicate unique values are
+// loaded so they can be fixed and the first *ErrUniqueViolation is returned
+func (db *Database) Load() error {
+	start := time.Now()
+	db.m.Lock()
+	tables := append([]dbTable{}, db.tables...)
+	db.m.Unlock()
+
+	errs := make([]error, len(tables))
+	var wg sync.WaitGroup
+	for i, t := range tables {
+		wg.Add(1)
+		go func(i int, t dbTable) {
+			defer wg.Done()
+			if e := t.load(); e != nil {
+				errs[i] = fmt.Errorf("table %s : %w", t.tableName(), e)
+			}
+		}(i, t)
+	}
+	wg.Wait()
+	var dup error
+	for _, e := range errs {
+		var uv *ErrUniqueViolation
+		if errors.As(e, &uv) {
+			if dup == nil {
+				dup = e
+			}
+		} else if e != nil {
+			return e
+		}
+	}
+	// the journal must be replayed before a save empties it
+	if e := db.replay(); e != nil {
+		return e
+	}
+	log.Println("database load time =", time.Since(start))
+	db.startTimer()
+	return dup
+}
+
+// replay the journal over the loaded tables
+func (db *Database) replay() error {
+	db.m.Lock()
+	defer db.m.Unlock()
+	if db.journal == nil {
+		db.replayed = true
+		return nil
+	}
+	e := replayLog(db.journal, journalFilename, func(recs []walRecord) error {
+		// an entry can have records for more than one table
+		byTable := make(map[string][]walRecord)
+		var order []string
+		for _, rec := range recs {
+			if _, ok := byTable[rec.Table]; !ok {
+				order = append(order, rec.Table)
+			}
+			byTable[rec.Table] = append(byTable[rec.Table], rec)
+		}
+		for _, name := range order {
+			t, ok := db.names[name]
+			if !ok {
+				return fmt.Errorf("table %s not registered", name)
+			}
+			if e := t.applyLog(byTable[name]); e != nil {
+				return e
+			}
+		}
+		return nil
+	})
+	db.replayed = e == nil
+	return e
+}
+
+// Save all dirty tables together, writes are blocked on all tables while saving.
+// The journal is emptied after all tables are saved
+func (db *Database) Save() error {
+	db.m.Lock()
+	defer db.m.Unlock()
+	return db.save(false)
+}
+
+// save dirty or all tables, callers must hold db.m
+func (db *Database) save(all bool) error {
+	if db.WAL && !db.replayed {
+		// the gob files do not have the journal changes yet
+		return ErrNotReplayed
+	}
+	start := time.Now()
+	type result struct {
+		rows  int
+		e     error
+		saved bool
+	}
+	results := make([]result, len(db.tables))
+	var err error
+
+	tables := sortTables(db.tables)
+	for _, t := range tables {
+		t.lock()
+	}
+	for i, t := range db.tables {
+		if !all && !t.dirty() {
+			continue
+		}
+		e := t.save()
+		results[i] = result{rows: t.rowCount(), e: e, saved: true}
+		if e != nil && err == nil {
+			err = fmt.Errorf("table %s : %w", t.tableName(), e)
+		}
+	}
+	// changes are in the gob files now
+	if err == nil && (db.journalErr != nil || db.journal != nil && db.journal.Count() > 0) {
+		sf, e := truncateLog(db.journal, filepath.Join(db.Dir, journalFilename))
+		db.journal = sf
+		db.journalErr = e
+		for _, t := range db.tables {
+			t.setJournal(sf, e)
+		}
+		err = e
+	}
+	for _, t := range tables {
+		t.unlock()
+	}
+
+	for i, t := range db.tables {
+		if results[i].saved {
+			t.onSave(results[i].rows, start, results[i].e)
+		}
+	}
+	return err
+}
+
+// Snapshot writes a consistent copy of all tables to dir,
+// writes are blocked on all tables until the snapshot is done
+func (db *Database) Snapshot(dir string) error {
+	start := time.Now()
+	if e := os.MkdirAll(dir, 0755); e != nil {
+		return e
+	}
+	db.m.Lock()
+	defer db.m.Unlock()
+	tables := sortTables(db.tables)
+	for _, t := range tables {
+		t.rlock()
+	}
+	defer func() {
+		for _, t := range tables {
+			t.runlock()
+		}
+	}()
+	for _, t := range db.tables {
+		if e := t.writeGob(filepath.Join(dir, t.tableName()+".gob"), false); e != nil {
+			return fmt.Errorf("table %s : %w", t.tableName(), e)
+		}
+	}
+	log.Println("database snapshot time =", time.Since(start))
+	return nil
+}
+
+// Close stops the save timers and saves all tables, tables are not saved if the journal
+// was not replayed
+func (db *Database) Close() error {
+	log.Println("--- closing database ---")
+	db.stopTimer()
+	db.m.Lock()
+	defer db.m.Unlock()
+	e := db.save(true)
+	if e != nil && !errors.Is(e, ErrNotReplayed) {
+		return e
+	}
+	for _, t := range db.tables {
+		t.shutdown()
+	}
+	if db.journal != nil {
+		db.journal.Close()
+		db.journal = nil
+	}
+	return e
+}
+
+func (db *Database) startTimer() {
+	db.m.Lock()
+	defer db.m.Unlock()
+	if db.stimer != nil {
+		return
+	}
+	d := db.SaveInterval
+	if d <= 0 {
+		d = SAVE_TIMER * time.Second
+	}
+	db.stimer = time.NewTicker(d)
+	db.done = make(chan struct{})
+	go func(ticker *time.Ticker, done chan struct{}) {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			if e := db.Save(); e != nil {
+				log.Println("database save error", e)
+			}
+		}
+	}(db.stimer, db.done)
+}
+
+func (db *Database) stopTimer() {
+	db.m.Lock()
+	defer db.m.Unlock()
+	if db.stimer != nil {
+		db.stimer.Stop()
+		close(db.done)
+		db.stimer = nil
+	}
+}
+
+// dbTable implementation
+
+func (t *Table[T]) tableName() string {
+	return t.name
+}
+
+// load gob, json or start empty
+func (t *Table[T]) load() error {
+	e := t.LoadGob()
+	if e == nil || !errors.Is(e, os.ErrNotExist) {
+		return e
+	}
+	if t.JsonFilename != "" {
+		e = t.LoadJson(t.JsonFilename)
+		if e == nil || !errors.Is(e, os.ErrNotExist) {
+			return e
+		}
+	}
+	// new table
+	t.init()
+	return nil
+}
+
+func (t *Table[T]) setJournal(wal *storagefile.StorageFile, e error) {
+	t.wal = wal
+	t.walErr = e
+	t.sharedWAL = true
+}
+
+func (t *Table[T]) applyLog(recs []walRecord) error {
+	t.m.Lock()
+	defer t.m.Unlock()
+	return t.apply(recs)
+}
+
+func (t *Table[T]) dirty() bool {
+	return t.isDirty
+}
+
+func (t *Table[T]) rowCount() int {
+	return len(t.rows)
+}
+
+func (t *Table[T]) shutdown() {
+	t.stopTimer()
+	t.m.Lock()
+	t.closeWAL()
+	t.m.Unlock()
+}
+
+func (t *Table[T]) lock() {
+	t.m.Lock()
+}
+
+func (t *Table[T]) unlock() {
+	t.m.Unlock()
+}
+
+func (t *Table[T]) rlock() {
+	t.m.RLock()
+}
+
+func (t *Table[T]) runlock() {
+	t.m.RUnlock()
+}
@@ -0,0 +1,240 @@
+package rdblite
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mgholam/rdblite/storagefile"
+)
+
+type Customerdata struct {
+	BaseTable
+	Name string
+}
+
+func Test_database(t *testing.T) {
+	os.RemoveAll("test/db")
+	os.MkdirAll("test/db", 0755)
+	b, _ := json.Marshal(gendata())
+	os.WriteFile("test/db/people.json", b, 0644)
+
+	db, e := OpenDatabase("test/db")
+	if e != nil {
+		t.Fatal(e)
+	}
+	db.SaveInterval = 10 * time.Millisecond
+	people, _ := Register[Testdata](db, "people")
+	customers, _ := Register[Customerdata](db, "customers")
+	if _, e = Register[Customerdata](db, "customers"); e == nil {
+		t.Error("expected error for duplicate table name")
+	}
+	if e = db.Load(); e != nil {
+		t.Fatal(e)
+	}
+	if people.TotalRows() != 99 || customers.TotalRows() != 0 {
+		t.Error("load failed", people.TotalRows(), customers.TotalRows())
+	}
+
+	customers.AddUpdate(Customerdata{Name: "alice"})
+	// shared timer saves dirty tables
+	time.Sleep(50 * time.Millisecond)
+	if !fileExists("test/db/customers.gob") || fileExists("test/db/people.gob") {
+		t.Error("timer should only save the dirty table")
+	}
+
+	if e = db.Snapshot("test/db/snap"); e != nil {
+		t.Fatal(e)
+	}
+	if e = db.Close(); e != nil {
+		t.Fatal(e)
+	}
+
+	// reopen from the snapshot
+	db, _ = OpenDatabase("test/db/snap")
+	people, _ = Register[Testdata](db, "people")
+	customers, _ = Register[Customerdata](db, "customers")
+	if e = db.Load(); e != nil {
+		t.Fatal(e)
+	}
+	if people.TotalRows() != 99 || customers.TotalRows() != 1 {
+		t.Error("snapshot load failed", people.TotalRows(), customers.TotalRows())
+	}
+	db.Close()
+
+	// corrupt gob is an error
+	os.WriteFile("test/db/people.gob", []byte("bad"), 0644)
+	db, _ = OpenDatabase("test/db")
+	Register[Testdata](db, "people")
+	if e = db.Load(); e == nil {
+		t.Error("expected load error")
+	}
+	db.stopTimer()
+
+	// seed from a json file outside the directory
+	os.RemoveAll("test/db/seeded")
+	db, _ = OpenDatabase("test/db/seeded")
+	people, _ = Register[Testdata](db, "people")
+	people.JsonFilename = "test/db/people.json"
+	if e = db.Load(); e != nil || people.TotalRows() != 99 {
+		t.Error("json seed failed", people.TotalRows(), e)
+	}
+	db.stopTimer()
+}
+
+func Test_database_tx(t *testing.T) {
+	os.RemoveAll("test/dbtx")
+	open := func() (*Database, *Table[Testdata], *Table[Customerdata]) {
+		db, e := OpenDatabase("test/dbtx")
+		if e != nil {
+			t.Fatal(e)
+		}
+		db.WAL = true
+		people, _ := Register[Testdata](db, "people")
+		customers, _ := Register[Customerdata](db, "customers")
+		if e = db.Load(); e != nil {
+			t.Fatal(e)
+		}
+		return db, people, customers
+	}
+	db, people, customers := open()
+
+	dtx := db.Begin()
+	ptx, _ := TxFor(dtx, people)
+	ctx, _ := TxFor(dtx, customers)
+	if tx, _ := TxFor(dtx, people); tx != ptx {
+		t.Error("expected the same transaction for a table")
+	}
+	ptx.AddUpdate(Testdata{Name: "bob"})
+	ctx.AddUpdate(Customerdata{Name: "alice"})
+	if e := ptx.Commit(); e != ErrTxDatabase {
+		t.Error("expected ErrTxDatabase got", e)
+	}
+	if people.TotalRows() != 0 {
+		t.Error("changes should not be visible before commit")
+	}
+	if e := dtx.Commit(); e != nil {
+		t.Fatal(e)
+	}
+	if people.TotalRows() != 1 || customers.TotalRows() != 1 {
+		t.Error("commit failed", people.TotalRows(), customers.TotalRows())
+	}
+
+	dtx = db.Begin()
+	ptx, _ = TxFor(dtx, people)
+	ctx, _ = TxFor(dtx, customers)
+	ptx.AddUpdate(Testdata{Name: "tom"})
+	ctx.Delete(1)
+	ctx.Rollback()
+	if _, e := ptx.AddUpdate(Testdata{Name: "x"}); e != ErrTxDone {
+		t.Error("expected ErrTxDone got", e)
+	}
+	if e := dtx.Commit(); e != ErrTxDone {
+		t.Error("expected ErrTxDone got", e)
+	}
+	if people.TotalRows() != 1 || customers.TotalRows() != 1 {
+		t.Error("rollback failed", people.TotalRows(), customers.TotalRows())
+	}
+
+	other := &Table[Testdata]{}
+	if _, e := TxFor(db.Begin(), other); e == nil {
+		t.Error("expected error for a table not in the database")
+	}
+
+	// crash without saving, the journal is replayed on load
+	db.stopTimer()
+	db.journal.Close()
+	db, people, customers = open()
+	if people.TotalRows() != 1 || customers.TotalRows() != 1 {
+		t.Error("journal replay failed", people.TotalRows(), customers.TotalRows())
+	}
+
+	// save empties the journal
+	dtx = db.Begin()
+	ctx, _ = TxFor(dtx, customers)
+	ctx.AddUpdate(Customerdata{Name: "carol"})
+	dtx.Commit()
+	if e := db.Save(); e != nil {
+		t.Fatal(e)
+	}
+	if db.journal.Count() != 0 {
+		t.Error("journal not truncated", db.journal.Count())
+	}
+	customers.AddUpdate(Customerdata{Name: "dave"})
+	if e := db.Close(); e != nil {
+		t.Fatal(e)
+	}
+	db, people, customers = open()
+	if people.TotalRows() != 1 || customers.TotalRows() != 3 {
+		t.Error("reload failed", people.TotalRows(), customers.TotalRows())
+	}
+	db.Close()
+}
+
+func Test_database_load_errors(t *testing.T) {
+	os.RemoveAll("test/dbdup")
+	os.MkdirAll("test/dbdup", 0755)
+	seed := func(rows []Contactdata) {
+		for i := range rows {
+			rows[i].ID = i + 1
+		}
+		b, _ := json.Marshal(rows)
+		os.WriteFile("test/dbdup/contacts.json", b, 0644)
+	}
+	open := func() (*Database, *Table[Contactdata], error) {
+		db, _ := OpenDatabase("test/dbdup")
+		db.WAL = true
+		contacts, _ := Register[Contactdata](db, "contacts")
+		return db, contacts, db.Load()
+	}
+	seed([]Contactdata{{Email: "a"}, {Email: "b"}})
+	db, contacts, e := open()
+	if e != nil {
+		t.Fatal(e)
+	}
+	id := contacts.AddUpdate(Contactdata{Name: "journal", Email: "c"})
+	// crash without saving
+	db.stopTimer()
+	db.journal.Close()
+
+	// duplicates are returned after the journal is replayed
+	seed([]Contactdata{{Email: "a"}, {Email: "a"}})
+	db, contacts, e = open()
+	var ue *ErrUniqueViolation
+	if !errors.As(e, &ue) {
+		t.Error("expected unique violation got", e)
+	}
+	if _, r := contacts.FindByID(id); r.Name != "journal" {
+		t.Error("journal not replayed", r)
+	}
+	if e = db.Close(); e != nil {
+		t.Fatal(e)
+	}
+	db, contacts, _ = open()
+	if _, r := contacts.FindByID(id); r.Name != "journal" {
+		t.Error("journal row lost on save", r)
+	}
+	contacts.AddUpdate(Contactdata{Name: "second", Email: "d"})
+	db.stopTimer()
+	db.journal.Close()
+
+	// a load error leaves the journal for the next load
+	os.WriteFile("test/dbdup/contacts.gob", []byte("bad"), 0644)
+	db, _, e = open()
+	if e == nil {
+		t.Error("expected load error")
+	}
+	if e = db.Save(); e != ErrNotReplayed {
+		t.Error("expected ErrNotReplayed got", e)
+	}
+	if e = db.Close(); e != ErrNotReplayed {
+		t.Error("expected ErrNotReplayed got", e)
+	}
+	sf, _ := storagefile.Open("test/dbdup/" + journalFilename)
+	if sf.Count() != 1 {
+		t.Error("journal truncated", sf.Count())
+	}
+	sf.Close()
+}
@@ -0,0 +1,287 @@
+package rdblite
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// field is a resolved struct field of a table row type
+type field struct {
+	name   string
+	path   []int // reflect index path, handles embedded structs
+	typ    reflect.Type
+	flags  []string
+	base   bool               // field of the embedded BaseTable
+	search bool               // included in rowstr for Search()
+	format func(v any) string // custom text for Search(), see SetFormatter()
+}
+
+// lookupField finds an exported field by name on T including embedded structs
+func lookupField[T any](name string) (field, error) {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	sf, ok := typ.FieldByName(name)
+	if !ok {
+		return field{}, fmt.Errorf("field %s not found in %s", name, typ.Name())
+	}
+	if !sf.IsExported() {
+		return field{}, fmt.Errorf("field %s in %s is not exported", name, typ.Name())
+	}
+	return field{
+		name:  sf.Name,
+		path:  sf.Index,
+		typ:   sf.Type,
+		flags: tagFlags(sf),
+	}, nil
+}
+
+// taggedFields returns all exported fields of T with their `rdb:"..."` tag flags
+func taggedFields[T any]() []field {
+	var fields []field
+	var walk func(typ reflect.Type, path []int, base bool)
+	walk = func(typ reflect.Type, path []int, base bool) {
+		for i := 0; i < typ.NumField(); i++ {
+			sf := typ.Field(i)
+			p := append(append([]int{}, path...), i)
+			if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+				walk(sf.Type, p, base || sf.Type == reflect.TypeOf(BaseTable{}))
+				continue
+			}
+			if !sf.IsExported() {
+				continue
+			}
+			fields = append(fields, field{
+				name:  sf.Name,
+				path:  p,
+				typ:   sf.Type,
+				flags: tagFlags(sf),
+				base:  base,
+			})
+		}
+	}
+	walk(reflect.TypeOf((*T)(nil)).Elem(), nil, false)
+	return fields
+}
+
+// tagFlags splits `rdb:"index,..."` into its comma separated flags
+func tagFlags(sf reflect.StructField) []string {
+	tag, ok := sf.Tag.Lookup("rdb")
+	if !ok || tag == "" {
+		return nil
+	}
+	flags := strings.Split(tag, ",")
+	for i := range flags {
+		flags[i] = strings.TrimSpace(flags[i])
+	}
+	return flags
+}
+
+func (f field) has(flag string) bool {
+	for _, s := range f.flags {
+		if s == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// option returns the value of a `key=value` flag
+func (f field) option(key string) (string, bool) {
+	for _, s := range f.flags {
+		if strings.HasPrefix(s, key+"=") {
+			return s[len(key)+1:], true
+		}
+	}
+	return "", false
+}
+
+// value of the field for a row
+func (f field) value(r any) reflect.Value {
+	return reflect.ValueOf(r).Elem().FieldByIndex(f.path)
+}
+
+// key of the field for a row in a hash index
+func (f field) key(r any) any {
+	return hashKey(f.value(r))
+}
+
+// hashKey is the value as a map key, time.Time is the UTC instant without the monotonic clock
+// so == matches the same instant in any location
+func hashKey(v reflect.Value) any {
+	k := v.Interface()
+	if tm, ok := k.(time.Time); ok {
+		return tm.Round(0).UTC()
+	}
+	return k
+}
+
+// text of the field for a row lower cased for searching
+func (f field) text(r any) string {
+	v := f.value(r)
+	if f.format != nil {
+		return strings.ToLower(f.format(v.Interface()))
+	}
+	return strings.ToLower(formatValue(v))
+}
+
+// formatValue as predictable text, time.Time without the monotonic clock and zero times as empty
+func formatValue(v reflect.Value) string {
+	if v.Type() == reflect.TypeOf(time.Time{}) {
+		tm := v.Interface().(time.Time)
+		if tm.IsZero() {
+			return ""
+		}
+		return tm.Format("2006-01-02 15:04:05")
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return ""
+		}
+		return formatValue(v.Elem())
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// searchable marks the fields that go in rowstr :
+// only fields tagged `rdb:"search"` if there are any,
+// otherwise all fields except BaseTable, bool and `rdb:"nosearch"` fields
+func searchable(fields []field) {
+	tagged := false
+	for _, f := range fields {
+		if f.has("search") {
+			tagged = true
+			break
+		}
+	}
+	for i, f := range fields {
+		if tagged {
+			fields[i].search = f.has("search")
+			continue
+		}
+		fields[i].search = !f.base && !f.has("nosearch") && f.typ.Kind() != reflect.Bool
+	}
+}
+
+// convert a caller supplied value to the field type for comparing and map keys.
+// Numbers are converted only if the value is kept exactly, floats to floats always,
+// other values only to a type of the same kind so 65 is never "A"
+func (f field) convert(v any) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return reflect.Value{}, fmt.Errorf("nil value for field %s", f.name)
+	}
+	if rv.Type() == f.typ {
+		return rv, nil
+	}
+	if !rv.Type().ConvertibleTo(f.typ) {
+		return reflect.Value{}, fmt.Errorf("value of type %s can not be used for field %s of type %s", rv.Type(), f.name, f.typ)
+	}
+	from, to := numberKind(rv.Kind()), numberKind(f.typ.Kind())
+	switch {
+	case from == 0 && to == 0:
+		if rv.Kind() == f.typ.Kind() {
+			return rv.Convert(f.typ), nil
+		}
+	case from == reflect.Float64 && to == reflect.Float64:
+		return rv.Convert(f.typ), nil
+	case from != 0 && to != 0:
+		if c, ok := exactNumber(rv, f.typ); ok {
+			return c, nil
+		}
+		return reflect.Value{}, fmt.Errorf("value %v can not be stored exactly in field %s of type %s", v, f.name, f.typ)
+	}
+	return reflect.Value{}, fmt.Errorf("value of type %s can not be used for field %s of type %s", rv.Type(), f.name, f.typ)
+}
+
+// numberKind groups kinds as reflect.Int64, reflect.Uint64 or reflect.Float64, 0 if not a number
+func numberKind(k reflect.Kind) reflect.Kind {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return reflect.Int64
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return reflect.Uint64
+	case reflect.Float32, reflect.Float64:
+		return reflect.Float64
+	}
+	return 0
+}
+
+// exactNumber converts a number to typ if converting back gives the same value
+func exactNumber(rv reflect.Value, typ reflect.Type) (reflect.Value, bool) {
+	from, to := numberKind(rv.Kind()), numberKind(typ.Kind())
+	// negative values wrap around in unsigned types and back
+	if to == reflect.Uint64 && (from == reflect.Int64 && rv.Int() < 0 || from == reflect.Float64 && rv.Float() < 0) {
+		return reflect.Value{}, false
+	}
+	c := rv.Convert(typ)
+	if from == reflect.Uint64 && to == reflect.Int64 && c.Int() < 0 {
+		return reflect.Value{}, false
+	}
+	if c.Convert(rv.Type()).Interface() != rv.Interface() {
+		return reflect.Value{}, false
+	}
+	return c, true
+}
+
+// comparer returns an ordering function for int, uint, float, string, bool and time.Time fields
+func comparer(typ reflect.Type) (func(a, b reflect.Value) int, bool) {
+	if typ == reflect.TypeOf(time.Time{}) {
+		return func(a, b reflect.Value) int {
+			ta := a.Interface().(time.Time)
+			tb := b.Interface().(time.Time)
+			if ta.Before(tb) {
+				return -1
+			}
+			if ta.After(tb) {
+				return 1
+			}
+			return 0
+		}, true
+	}
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(a, b reflect.Value) int {
+			return cmp3(a.Int() < b.Int(), a.Int() > b.Int())
+		}, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return func(a, b reflect.Value) int {
+			return cmp3(a.Uint() < b.Uint(), a.Uint() > b.Uint())
+		}, true
+	case reflect.Float32, reflect.Float64:
+		return func(a, b reflect.Value) int {
+			return cmp3(a.Float() < b.Float(), a.Float() > b.Float())
+		}, true
+	case reflect.String:
+		return func(a, b reflect.Value) int {
+			return strings.Compare(a.String(), b.String())
+		}, true
+	case reflect.Bool:
+		return func(a, b reflect.Value) int {
+			return cmp3(!a.Bool() && b.Bool(), a.Bool() && !b.Bool())
+		}, true
+	}
+	return nil, false
+}
+
+func cmp3(less, greater bool) int {
+	if less {
+		return -1
+	}
+	if greater {
+		return 1
+	}
+	return 0
+}
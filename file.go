@@ -0,0 +1,105 @@
+package rdblite
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// writeFileAtomic writes to a temp file which is fsynced and renamed over filename,
+// so filename is always the old or the new complete file. With backup the old file is kept as filename.bak
+func writeFileAtomic(filename string, backup bool, write func(w io.Writer) error) error {
+	dir := filepath.Dir(filename)
+	f, e := os.CreateTemp(dir, filepath.Base(filename)+".*.tmp")
+	if e != nil {
+		return e
+	}
+	tmp := f.Name()
+	fail := func(e error) error {
+		f.Close()
+		os.Remove(tmp)
+		return e
+	}
+	// CreateTemp is owner only, keep the mode of the old file so other users can still read it
+	mode := os.FileMode(0644)
+	if fi, e := os.Stat(filename); e == nil {
+		mode = fi.Mode().Perm()
+	}
+	if e = f.Chmod(mode); e != nil {
+		return fail(e)
+	}
+
+	w := bufio.NewWriter(f)
+	if e = write(w); e != nil {
+		return fail(e)
+	}
+	if e = w.Flush(); e != nil {
+		return fail(e)
+	}
+	if e = f.Sync(); e != nil {
+		return fail(e)
+	}
+	if e = f.Close(); e != nil {
+		os.Remove(tmp)
+		return e
+	}
+
+	if backup && fileExists(filename) {
+		bak := filename + ".bak"
+		os.Remove(bak)
+		// hard link so filename is never missing, copy if links are not supported
+		if e = os.Link(filename, bak); e != nil {
+			if e = copyFile(filename, bak); e != nil {
+				os.Remove(tmp)
+				return e
+			}
+		}
+	}
+
+	if e = os.Rename(tmp, filename); e != nil {
+		os.Remove(tmp)
+		return e
+	}
+	return syncDir(dir)
+}
+
+// syncDir makes a rename durable, not supported on windows
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, e := os.Open(dir)
+	if e != nil {
+		return e
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+func copyFile(src, dst string) error {
+	in, e := os.Open(src)
+	if e != nil {
+		return e
+	}
+	defer in.Close()
+	out, e := os.Create(dst)
+	if e != nil {
+		return e
+	}
+	if _, e = io.Copy(out, in); e != nil {
+		out.Close()
+		return e
+	}
+	if e = out.Sync(); e != nil {
+		out.Close()
+		return e
+	}
+	return out.Close()
+}
+
+func fileExists(fn string) bool {
+	_, e := os.Stat(fn)
+	return e == nil
+}
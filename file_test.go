@@ -0,0 +1,88 @@
+package rdblite
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_write_atomic(t *testing.T) {
+	os.Mkdir("test", 0755)
+	fn := "test/atomic.dat"
+	os.Remove(fn)
+	os.Remove(fn + ".bak")
+
+	write := func(s string) func(w io.Writer) error {
+		return func(w io.Writer) error {
+			_, e := w.Write([]byte(s))
+			return e
+		}
+	}
+	if e := writeFileAtomic(fn, true, write("one")); e != nil {
+		t.Fatal(e)
+	}
+	if fileExists(fn + ".bak") {
+		t.Error("no backup expected for a new file")
+	}
+	if e := writeFileAtomic(fn, true, write("two")); e != nil {
+		t.Fatal(e)
+	}
+	if b, _ := os.ReadFile(fn); string(b) != "two" {
+		t.Error("expected two got", string(b))
+	}
+	if b, _ := os.ReadFile(fn + ".bak"); string(b) != "one" {
+		t.Error("expected backup one got", string(b))
+	}
+
+	// new files are 0644 and saves keep the mode of the old file
+	if fi, _ := os.Stat(fn); fi.Mode().Perm() != 0644 {
+		t.Error("expected mode 0644 got", fi.Mode().Perm())
+	}
+	os.Chmod(fn, 0640)
+	writeFileAtomic(fn, false, write("three"))
+	if fi, _ := os.Stat(fn); fi.Mode().Perm() != 0640 {
+		t.Error("expected mode 0640 got", fi.Mode().Perm())
+	}
+	writeFileAtomic(fn, false, write("two"))
+
+	// a failed write leaves the old file and no temp files
+	e := writeFileAtomic(fn, false, func(w io.Writer) error {
+		w.Write([]byte("partial"))
+		return errors.New("disk full")
+	})
+	if e == nil {
+		t.Error("expected error")
+	}
+	if b, _ := os.ReadFile(fn); string(b) != "two" {
+		t.Error("old file changed", string(b))
+	}
+	if m, _ := filepath.Glob("test/atomic.dat.*.tmp"); len(m) > 0 {
+		t.Error("temp files left", m)
+	}
+}
+
+func Test_savegob_backup(t *testing.T) {
+	createTest()
+	tt := Table[Testdata]{
+		GobFilename: "test/test.gob",
+		KeepBackup:  true,
+	}
+	tt.LoadGob()
+	tt.Delete(1)
+	if e := tt.Close(); e != nil {
+		t.Fatal(e)
+	}
+
+	bak := Table[Testdata]{
+		GobFilename: "test/test.gob.bak",
+	}
+	if e := bak.LoadGob(); e != nil {
+		t.Fatal(e)
+	}
+	bak.stopTimer()
+	if bak.TotalRows() != 99 || tt.TotalRows() != 98 {
+		t.Error("backup should have the previous rows", bak.TotalRows(), tt.TotalRows())
+	}
+}
@@ -0,0 +1,145 @@
+package rdblite
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// invertedIndex maps the words in rowstr to the IDs of the rows containing them
+type invertedIndex struct {
+	postings map[string]map[int]struct{}
+}
+
+func newInvertedIndex() *invertedIndex {
+	return &invertedIndex{
+		postings: make(map[string]map[int]struct{}),
+	}
+}
+
+// words splits lower cased text on anything that is not a letter or digit
+func words(str string) []string {
+	return strings.FieldsFunc(str, func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+	})
+}
+
+func (ix *invertedIndex) add(id int, str string) {
+	for _, w := range words(str) {
+		ids, ok := ix.postings[w]
+		if !ok {
+			ids = make(map[int]struct{})
+			ix.postings[w] = ids
+		}
+		ids[id] = struct{}{}
+	}
+}
+
+func (ix *invertedIndex) remove(id int, str string) {
+	for _, w := range words(str) {
+		ids, ok := ix.postings[w]
+		if !ok {
+			continue
+		}
+		delete(ids, id)
+		if len(ids) == 0 {
+			delete(ix.postings, w)
+		}
+	}
+}
+
+func (ix *invertedIndex) has(word string, id int) bool {
+	_, ok := ix.postings[word][id]
+	return ok
+}
+
+// lookup intersects the postings of all the words, smallest first
+func (ix *invertedIndex) lookup(ws []string) map[int]struct{} {
+	lists := make([]map[int]struct{}, 0, len(ws))
+	for _, w := range ws {
+		ids := ix.postings[w]
+		if len(ids) == 0 {
+			return nil
+		}
+		lists = append(lists, ids)
+	}
+	sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+	set := make(map[int]struct{}, len(lists[0]))
+	for id := range lists[0] {
+		set[id] = struct{}{}
+	}
+	for _, l := range lists[1:] {
+		set = intersect(set, l)
+	}
+	return set
+}
+
+func intersect(a, b map[int]struct{}) map[int]struct{} {
+	set := make(map[int]struct{})
+	for id := range a {
+		if _, ok := b[id]; ok {
+			set[id] = struct{}{}
+		}
+	}
+	return set
+}
+
+// wordNode matches whole words using the inverted index, a phrase is also checked against rowstr
+type wordNode[T tableInterface] struct {
+	ix    *invertedIndex
+	words []string
+	term  string
+}
+
+func (n wordNode[T]) match(r *T) bool {
+	id := (*r).getID()
+	for _, w := range n.words {
+		if !n.ix.has(w, id) {
+			return false
+		}
+	}
+	if len(n.words) == 1 && n.words[0] == n.term {
+		return true
+	}
+	return (*r).contains(n.term)
+}
+
+func (n wordNode[T]) candidates() (map[int]struct{}, bool) {
+	return n.ix.lookup(n.words), true
+}
+
+// candidates returns the IDs that could match a node, false if the node can't narrow the rows
+func candidates[T tableInterface](node searchNode[T]) (map[int]struct{}, bool) {
+	switch n := node.(type) {
+	case wordNode[T]:
+		return n.candidates()
+	case andNode[T]:
+		var set map[int]struct{}
+		found := false
+		for _, c := range n.nodes {
+			ids, ok := candidates(c)
+			if !ok {
+				continue
+			}
+			if !found {
+				set, found = ids, true
+			} else {
+				set = intersect(set, ids)
+			}
+		}
+		return set, found
+	case orNode[T]:
+		set := make(map[int]struct{})
+		for _, c := range n.nodes {
+			ids, ok := candidates(c)
+			if !ok {
+				return nil, false
+			}
+			for id := range ids {
+				set[id] = struct{}{}
+			}
+		}
+		return set, true
+	}
+	return nil, false
+}
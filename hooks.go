@@ -0,0 +1,95 @@
+package rdblite
+
+// Validator is implemented by row types that check their fields before every write,
+// a non nil error rejects the write
+type Validator interface {
+	Validate() error
+}
+
+// BeforeSaver is implemented by row types that change themselves before every write
+// like setting timestamps, a non nil error rejects the write
+type BeforeSaver interface {
+	BeforeSave() error
+}
+
+type tableHooks[T tableInterface] struct {
+	beforeWrite  []func(r *T) error
+	afterWrite   []func(r T)
+	beforeDelete []func(r T) error
+	afterDelete  []func(r T)
+}
+
+// BeforeWrite adds a hook run before a row is added or updated, it can change the row
+// or reject the write by returning an error.
+// Hooks run in the order added after T.BeforeSave() and before T.Validate() while the table is locked.
+// The error is returned by Insert(), Update(), Upsert() and Commit(), AddUpdate() only returns 0
+func (t *Table[T]) BeforeWrite(fn func(r *T) error) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	t.hooks.beforeWrite = append(t.hooks.beforeWrite, fn)
+}
+
+// AfterWrite adds a hook run after a row is added or updated while the table is locked
+func (t *Table[T]) AfterWrite(fn func(r T)) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	t.hooks.afterWrite = append(t.hooks.afterWrite, fn)
+}
+
+// BeforeDelete adds a hook run before a row is deleted, returning an error rejects the delete
+func (t *Table[T]) BeforeDelete(fn func(r T) error) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	t.hooks.beforeDelete = append(t.hooks.beforeDelete, fn)
+}
+
+// AfterDelete adds a hook run after a row is deleted while the table is locked
+func (t *Table[T]) AfterDelete(fn func(r T)) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	t.hooks.afterDelete = append(t.hooks.afterDelete, fn)
+}
+
+// beforeWrite runs T.BeforeSave(), the hooks and T.Validate(), the ID can not be changed.
+// Callers must hold the lock
+func (t *Table[T]) beforeWrite(r *T) error {
+	id := (*r).getID()
+	if bs, ok := any(r).(BeforeSaver); ok {
+		if e := bs.BeforeSave(); e != nil {
+			return e
+		}
+	}
+	for _, fn := range t.hooks.beforeWrite {
+		if e := fn(r); e != nil {
+			return e
+		}
+	}
+	setID(r, id)
+	if v, ok := any(r).(Validator); ok {
+		if e := v.Validate(); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+func (t *Table[T]) afterWrite(r *T) {
+	for _, fn := range t.hooks.afterWrite {
+		fn(*r)
+	}
+}
+
+func (t *Table[T]) beforeDelete(r *T) error {
+	for _, fn := range t.hooks.beforeDelete {
+		if e := fn(*r); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+func (t *Table[T]) afterDelete(r *T) {
+	for _, fn := range t.hooks.afterDelete {
+		fn(*r)
+	}
+}
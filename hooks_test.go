@@ -0,0 +1,102 @@
+package rdblite
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type Orderdata struct {
+	BaseTable
+	CustomerName string
+	ItemCount    int
+	Created      time.Time
+}
+
+var errNoCustomer = errors.New("customer name is empty")
+
+func (o *Orderdata) BeforeSave() error {
+	if o.Created.IsZero() {
+		o.Created = time.Date(2022, 8, 9, 0, 0, 0, 0, time.UTC)
+	}
+	return nil
+}
+
+func (o *Orderdata) Validate() error {
+	if o.CustomerName == "" {
+		return errNoCustomer
+	}
+	if o.ItemCount < 0 {
+		return errors.New("item count is negative")
+	}
+	return nil
+}
+
+func Test_hooks(t *testing.T) {
+	tt := Table[Orderdata]{}
+	defer tt.stopTimer()
+
+	var written, deleted []int
+	tt.BeforeWrite(func(r *Orderdata) error {
+		r.CustomerName = r.CustomerName + "!"
+		r.ID = 1000
+		return nil
+	})
+	tt.AfterWrite(func(r Orderdata) {
+		written = append(written, r.ID)
+	})
+	tt.BeforeDelete(func(r Orderdata) error {
+		if r.ItemCount > 10 {
+			return errors.New("can not delete large orders")
+		}
+		return nil
+	})
+	tt.AfterDelete(func(r Orderdata) {
+		deleted = append(deleted, r.ID)
+	})
+
+	id, e := tt.Insert(Orderdata{CustomerName: "bob", ItemCount: 20})
+	if e != nil {
+		t.Fatal(e)
+	}
+	_, r := tt.FindByID(id)
+	if id != 1 || r.CustomerName != "bob!" || r.Created.IsZero() {
+		t.Error("before hooks not applied", r)
+	}
+	if len(written) != 1 || written[0] != 1 {
+		t.Error("after write not called", written)
+	}
+
+	// Validate runs after the hooks so "" becomes "!" and passes
+	tt.BeforeWrite(func(r *Orderdata) error {
+		if r.CustomerName == "!" {
+			r.CustomerName = ""
+		}
+		return nil
+	})
+	if _, e = tt.Insert(Orderdata{}); e != errNoCustomer {
+		t.Error("expected validation error got", e)
+	}
+	if id := tt.AddUpdate(Orderdata{CustomerName: "a", ItemCount: -1}); id != 0 || tt.TotalRows() != 1 {
+		t.Error("invalid row was added")
+	}
+	if e = tt.Patch(1, map[string]any{"ItemCount": -5}); e == nil {
+		t.Error("expected validation error for patch")
+	}
+
+	if e = tt.Delete(1); e == nil || tt.TotalRows() != 1 {
+		t.Error("before delete should reject")
+	}
+	tt.Patch(1, map[string]any{"ItemCount": 1})
+	if e = tt.Delete(1); e != nil || len(deleted) != 1 {
+		t.Error("delete failed", e, deleted)
+	}
+
+	// a failed hook rejects the whole transaction
+	tx := tt.Begin()
+	tx.AddUpdate(Orderdata{CustomerName: "tx"})
+	tx.AddUpdate(Orderdata{})
+	if e = tx.Commit(); e != errNoCustomer || tt.TotalRows() != 0 {
+		t.Error("expected transaction to fail", e, tt.TotalRows())
+	}
+}
@@ -0,0 +1,301 @@
+package rdblite
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// hashIndex maps field values to the IDs of the rows holding that value
+type hashIndex struct {
+	field  field
+	unique bool
+	values map[any]map[int]struct{}
+}
+
+func newHashIndex(f field) *hashIndex {
+	return &hashIndex{
+		field:  f,
+		values: make(map[any]map[int]struct{}),
+	}
+}
+
+func (ix *hashIndex) add(id int, r any) {
+	key := ix.field.key(r)
+	ids, ok := ix.values[key]
+	if !ok {
+		ids = make(map[int]struct{})
+		ix.values[key] = ids
+	}
+	ids[id] = struct{}{}
+}
+
+func (ix *hashIndex) remove(id int, r any) {
+	key := ix.field.key(r)
+	ids, ok := ix.values[key]
+	if !ok {
+		return
+	}
+	delete(ids, id)
+	if len(ids) == 0 {
+		delete(ix.values, key)
+	}
+}
+
+// CreateIndex on a field of T, also done for fields tagged with `rdb:"index"`
+func (t *Table[T]) CreateIndex(fieldname string) error {
+	f, e := lookupField[T](fieldname)
+	if e != nil {
+		return e
+	}
+	if !f.typ.Comparable() {
+		return fmt.Errorf("field %s of type %s can not be indexed", f.name, f.typ)
+	}
+	t.m.Lock()
+	defer t.m.Unlock()
+	t.setup()
+	if _, ok := t.indexes[f.name]; ok {
+		return nil
+	}
+	ix := newHashIndex(f)
+	for _, r := range t.rows {
+		ix.add((*r).getID(), r)
+	}
+	t.indexes[f.name] = ix
+	return nil
+}
+
+// FindBy returns all rows where field == value using the index on field,
+// will do a full scan if the field is not indexed
+func (t *Table[T]) FindBy(fieldname string, value any) ([]T, error) {
+	start := time.Now()
+	t.m.RLock()
+	defer t.m.RUnlock()
+
+	var data []T
+	if ix, ok := t.indexes[fieldname]; ok {
+		key, e := ix.field.convert(value)
+		if e != nil {
+			return nil, e
+		}
+		var pos []int
+		for id := range ix.values[hashKey(key)] {
+			pos = append(pos, t.ids[id])
+		}
+		// keep storage order like Query
+		sort.Ints(pos)
+		for _, idx := range pos {
+			data = append(data, *t.rows[idx])
+		}
+		log.Println("find by index time =", time.Since(start))
+		return data, nil
+	}
+
+	f, e := lookupField[T](fieldname)
+	if e != nil {
+		return nil, e
+	}
+	key, e := f.convert(value)
+	if e != nil {
+		return nil, e
+	}
+	if !f.typ.Comparable() {
+		return nil, fmt.Errorf("field %s of type %s can not be compared", f.name, f.typ)
+	}
+	k := hashKey(key)
+	for _, r := range t.rows {
+		if f.key(r) == k {
+			data = append(data, *r)
+		}
+	}
+	log.Println("find by scan time =", time.Since(start))
+	return data, nil
+}
+
+// setup creates the ID map, search fields and the indexes declared with struct tags, callers must hold the lock
+func (t *Table[T]) setup() {
+	if t.ids == nil {
+		t.ids = make(map[int]int)
+	}
+	if t.fields == nil {
+		t.fields = taggedFields[T]()
+		searchable(t.fields)
+		for i, f := range t.fields {
+			t.fields[i].format = t.formatters[f.name]
+		}
+	}
+	if t.indexes != nil {
+		return
+	}
+	t.indexes = make(map[string]*hashIndex)
+	t.sorted = make(map[string]*sortedIndex)
+	if t.FullTextIndex {
+		t.fulltext = newInvertedIndex()
+	}
+	for _, f := range t.fields {
+		if f.has("index") || f.has("unique") {
+			if f.typ.Comparable() {
+				ix := newHashIndex(f)
+				ix.unique = f.has("unique")
+				t.indexes[f.name] = ix
+			} else {
+				log.Printf("field %s of type %s can not be indexed\n", f.name, f.typ)
+			}
+		}
+		if f.has("sorted") {
+			ix, e := newSortedIndex(f)
+			if e != nil {
+				log.Println(e)
+				continue
+			}
+			t.sorted[f.name] = ix
+		}
+	}
+}
+
+// indexRow adds the row to all secondary indexes and the full text index
+func (t *Table[T]) indexRow(r *T) {
+	id := (*r).getID()
+	for _, ix := range t.indexes {
+		ix.add(id, r)
+	}
+	for _, ix := range t.sorted {
+		ix.add(id, r)
+	}
+	if t.fulltext != nil {
+		t.fulltext.add(id, (*r).text())
+	}
+}
+
+// unindexRow removes the row from all secondary indexes and the full text index
+func (t *Table[T]) unindexRow(r *T) {
+	id := (*r).getID()
+	for _, ix := range t.indexes {
+		ix.remove(id, r)
+	}
+	for _, ix := range t.sorted {
+		ix.remove(id, r)
+	}
+	if t.fulltext != nil {
+		t.fulltext.remove(id, (*r).text())
+	}
+}
+
+// sortedIndex keeps the IDs of rows ordered by a field value for range queries
+type sortedIndex struct {
+	field field
+	list  *skipList
+}
+
+func newSortedIndex(f field) (*sortedIndex, error) {
+	cmp, ok := comparer(f.typ)
+	if !ok {
+		return nil, fmt.Errorf("field %s of type %s can not be sorted", f.name, f.typ)
+	}
+	return &sortedIndex{
+		field: f,
+		list:  newSkipList(cmp),
+	}, nil
+}
+
+// key copies the field value so the index does not hold on to the row
+func (ix *sortedIndex) key(r any) reflect.Value {
+	return reflect.ValueOf(ix.field.value(r).Interface())
+}
+
+func (ix *sortedIndex) add(id int, r any) {
+	ix.list.insert(ix.key(r), id)
+}
+
+func (ix *sortedIndex) remove(id int, r any) {
+	ix.list.remove(ix.key(r), id)
+}
+
+// CreateSortedIndex on an int, uint, float, string or time.Time field of T,
+// also done for fields tagged with `rdb:"sorted"`
+func (t *Table[T]) CreateSortedIndex(fieldname string) error {
+	f, e := lookupField[T](fieldname)
+	if e != nil {
+		return e
+	}
+	ix, e := newSortedIndex(f)
+	if e != nil {
+		return e
+	}
+	t.m.Lock()
+	defer t.m.Unlock()
+	t.setup()
+	if _, ok := t.sorted[f.name]; ok {
+		return nil
+	}
+	for _, r := range t.rows {
+		ix.add((*r).getID(), r)
+	}
+	t.sorted[f.name] = ix
+	return nil
+}
+
+// QueryRange returns rows where from <= field <= to ordered by field,
+// a nil from or to is open ended. Will scan and sort if the field has no sorted index
+func (t *Table[T]) QueryRange(fieldname string, from, to any) ([]T, error) {
+	start := time.Now()
+	var data []T
+	e := t.IterateOrdered(fieldname, from, to, func(row T) bool {
+		data = append(data, row)
+		return true
+	})
+	if e != nil {
+		return nil, e
+	}
+	log.Println("query range time =", time.Since(start))
+	return data, nil
+}
+
+// IterateOrdered calls fn for rows where from <= field <= to in field order until fn returns false,
+// a nil from or to is open ended.
+// * the table is locked while iterating so don't write to the table in fn
+func (t *Table[T]) IterateOrdered(fieldname string, from, to any, fn func(row T) bool) error {
+	t.m.RLock()
+	defer t.m.RUnlock()
+
+	ix, ok := t.sorted[fieldname]
+	if !ok {
+		f, e := lookupField[T](fieldname)
+		if e != nil {
+			return e
+		}
+		// no index so build a temporary one
+		ix, e = newSortedIndex(f)
+		if e != nil {
+			return e
+		}
+		for _, r := range t.rows {
+			ix.add((*r).getID(), r)
+		}
+	}
+
+	var lo, hi reflect.Value
+	var e error
+	if from != nil {
+		if lo, e = ix.field.convert(from); e != nil {
+			return e
+		}
+	}
+	if to != nil {
+		if hi, e = ix.field.convert(to); e != nil {
+			return e
+		}
+	}
+
+	for n := ix.list.seek(lo); n != nil; n = n.next[0] {
+		if hi.IsValid() && ix.list.cmp(n.key, hi) > 0 {
+			break
+		}
+		if !fn(*t.rows[t.ids[n.id]]) {
+			break
+		}
+	}
+	return nil
+}
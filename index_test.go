@@ -0,0 +1,170 @@
+package rdblite
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+type Indexdata struct {
+	BaseTable
+	Name   string
+	Status string `rdb:"index"`
+	Age    int
+	Date   time.Time `rdb:"sorted"`
+}
+
+func Test_index(t *testing.T) {
+	tt := Table[Indexdata]{
+		GobFilename: "test/index.gob",
+	}
+	for i := 0; i < 100; i++ {
+		status := "open"
+		if i%4 == 0 {
+			status = "closed"
+		}
+		tt.AddUpdate(Indexdata{Name: randStringRunes(10), Status: status, Age: i % 10})
+	}
+	if e := tt.CreateIndex("Age"); e != nil {
+		t.Fatal(e)
+	}
+	if e := tt.CreateIndex("Missing"); e == nil {
+		t.Error("expected error for missing field")
+	}
+
+	rows, _ := tt.FindBy("Status", "closed")
+	if len(rows) != 25 {
+		t.Error("expected 25 closed got", len(rows))
+	}
+	rows, _ = tt.FindBy("Age", 3)
+	if len(rows) != 10 {
+		t.Error("expected 10 with age 3 got", len(rows))
+	}
+
+	// update moves the row between index values
+	_, r := tt.FindByID(1)
+	r.Status = "open"
+	tt.AddUpdate(r)
+	rows, _ = tt.FindBy("Status", "closed")
+	if len(rows) != 24 {
+		t.Error("expected 24 closed got", len(rows))
+	}
+
+	// delete removes from the index
+	tt.Delete(5)
+	rows, _ = tt.FindBy("Status", "closed")
+	if len(rows) != 23 {
+		t.Error("expected 23 closed got", len(rows))
+	}
+
+	// not indexed does a scan
+	rows, e := tt.FindBy("Name", r.Name)
+	if e != nil || len(rows) != 1 {
+		t.Error("scan failed", e)
+	}
+
+	// values are converted only when exact
+	tt.AddUpdate(Indexdata{Name: "A"})
+	if _, e = tt.FindBy("Name", 65); e == nil {
+		t.Error("expected error for int to string")
+	}
+	if rows, e = tt.FindBy("Age", int8(3)); e != nil || len(rows) != 10 {
+		t.Error("int8 to int failed", len(rows), e)
+	}
+	if rows, e = tt.FindBy("Age", 3.0); e != nil || len(rows) != 10 {
+		t.Error("exact float to int failed", len(rows), e)
+	}
+	if _, e = tt.FindBy("Age", 3.5); e == nil {
+		t.Error("expected error for float to int")
+	}
+	tt.stopTimer()
+}
+
+func Test_sorted_index(t *testing.T) {
+	tt := Table[Indexdata]{
+		GobFilename: "test/sorted.gob",
+	}
+	day := time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 100; i++ {
+		tt.AddUpdate(Indexdata{Name: randStringRunes(10), Age: 99 - i, Date: day.AddDate(0, 0, i%30)})
+	}
+	if e := tt.CreateSortedIndex("Age"); e != nil {
+		t.Fatal(e)
+	}
+	if e := tt.CreateSortedIndex("Name"); e != nil {
+		t.Fatal(e)
+	}
+
+	rows, _ := tt.QueryRange("Date", day.AddDate(0, 0, 5), day.AddDate(0, 0, 9))
+	if len(rows) != 20 {
+		t.Error("expected 20 rows in date range got", len(rows))
+	}
+	for i := 1; i < len(rows); i++ {
+		if rows[i].Date.Before(rows[i-1].Date) {
+			t.Error("date range not ordered")
+		}
+	}
+
+	// open ended
+	rows, _ = tt.QueryRange("Age", nil, 9)
+	if len(rows) != 10 || rows[0].Age != 0 || rows[9].Age != 9 {
+		t.Error("age range failed", len(rows))
+	}
+
+	tt.Delete(100)          // Age 0
+	_, r := tt.FindByID(99) // Age 1
+	r.Age = 50
+	tt.AddUpdate(r)
+	rows, _ = tt.QueryRange("Age", 0, 9)
+	if len(rows) != 8 || rows[0].Age != 2 {
+		t.Error("age range after update failed", len(rows))
+	}
+
+	// no sorted index, scan and sort
+	count := 0
+	tt.IterateOrdered("ID", 10, nil, func(row Indexdata) bool {
+		count++
+		return count < 5
+	})
+	if count != 5 {
+		t.Error("iterate did not stop", count)
+	}
+	tt.stopTimer()
+}
+
+type Eventdata struct {
+	BaseTable
+	Created time.Time `rdb:"index"`
+	At      time.Time `rdb:"unique"`
+}
+
+func Test_index_time(t *testing.T) {
+	os.Mkdir("test", 0755)
+	now := time.Now().In(time.FixedZone("X", 3600))
+	tt := Table[Eventdata]{
+		GobFilename: "test/events.gob",
+	}
+	id := tt.AddUpdate(Eventdata{Created: now, At: now})
+	tt.SaveGob()
+	tt.stopTimer()
+
+	// the gob round trip drops the monotonic clock
+	t2 := Table[Eventdata]{
+		GobFilename: "test/events.gob",
+	}
+	if e := t2.LoadGob(); e != nil {
+		t.Fatal(e)
+	}
+	defer t2.stopTimer()
+	for _, v := range []time.Time{now, now.UTC(), now.Round(0)} {
+		if rows, e := t2.FindBy("Created", v); e != nil || len(rows) != 1 || rows[0].ID != id {
+			t.Error("same instant not found", v, len(rows), e)
+		}
+	}
+	// the same instant in another location is a duplicate
+	var ue *ErrUniqueViolation
+	if _, e := t2.Insert(Eventdata{At: now.UTC()}); !errors.As(e, &ue) {
+		t.Error("expected unique violation got", e)
+	}
+}
@@ -0,0 +1,128 @@
+package rdblite
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// Pair is a joined left and right row, Right is nil in a left join without a match
+type Pair[L, R tableInterface] struct {
+	Left  L
+	Right *R
+}
+
+// JoinByID joins rows of left matching pred (nil for all) to the right row with the ID key(row)
+// using the ID map, rows without a match are skipped
+func JoinByID[L, R tableInterface](left *Table[L], pred func(row L) bool, key func(row L) int, right *Table[R]) []Pair[L, R] {
+	return joinByID(left, pred, key, right, false)
+}
+
+// LeftJoinByID is JoinByID that keeps left rows without a match with a nil Right
+func LeftJoinByID[L, R tableInterface](left *Table[L], pred func(row L) bool, key func(row L) int, right *Table[R]) []Pair[L, R] {
+	return joinByID(left, pred, key, right, true)
+}
+
+func joinByID[L, R tableInterface](left *Table[L], pred func(row L) bool, key func(row L) int, right *Table[R], outer bool) []Pair[L, R] {
+	start := time.Now()
+	unlock := rlockTables(left, right)
+	defer unlock()
+
+	var data []Pair[L, R]
+	for _, l := range left.rows {
+		if pred != nil && !pred(*l) {
+			continue
+		}
+		if found, idx := right.findIndex(key(*l)); found {
+			r := *right.rows[idx]
+			data = append(data, Pair[L, R]{Left: *l, Right: &r})
+		} else if outer {
+			data = append(data, Pair[L, R]{Left: *l})
+		}
+	}
+	log.Println("join by id time =", time.Since(start))
+	return data
+}
+
+// JoinOn joins rows of left matching pred (nil for all) to every right row where field == key(row)
+// using the index on field, or a temporary one if the field is not indexed. Rows without a match are skipped
+func JoinOn[L, R tableInterface](left *Table[L], pred func(row L) bool, key func(row L) any, right *Table[R], fieldname string) ([]Pair[L, R], error) {
+	return joinOn(left, pred, key, right, fieldname, false)
+}
+
+// LeftJoinOn is JoinOn that keeps left rows without a match with a nil Right
+func LeftJoinOn[L, R tableInterface](left *Table[L], pred func(row L) bool, key func(row L) any, right *Table[R], fieldname string) ([]Pair[L, R], error) {
+	return joinOn(left, pred, key, right, fieldname, true)
+}
+
+func joinOn[L, R tableInterface](left *Table[L], pred func(row L) bool, key func(row L) any, right *Table[R], fieldname string, outer bool) ([]Pair[L, R], error) {
+	start := time.Now()
+	f, e := lookupField[R](fieldname)
+	if e != nil {
+		return nil, e
+	}
+	if !f.typ.Comparable() {
+		return nil, fmt.Errorf("field %s of type %s can not be joined on", f.name, f.typ)
+	}
+	unlock := rlockTables(left, right)
+	defer unlock()
+
+	ix, ok := right.indexes[f.name]
+	if !ok {
+		// no index so build a temporary one
+		ix = newHashIndex(f)
+		for _, r := range right.rows {
+			ix.add((*r).getID(), r)
+		}
+	}
+
+	var data []Pair[L, R]
+	for _, l := range left.rows {
+		if pred != nil && !pred(*l) {
+			continue
+		}
+		k, e := f.convert(key(*l))
+		if e != nil {
+			return nil, e
+		}
+		var pos []int
+		for id := range ix.values[hashKey(k)] {
+			pos = append(pos, right.ids[id])
+		}
+		// keep storage order like Query
+		sort.Ints(pos)
+		for _, idx := range pos {
+			r := *right.rows[idx]
+			data = append(data, Pair[L, R]{Left: *l, Right: &r})
+		}
+		if len(pos) == 0 && outer {
+			data = append(data, Pair[L, R]{Left: *l})
+		}
+	}
+	log.Println("join on time =", time.Since(start))
+	return data, nil
+}
+
+// rlockTables read locks the tables in lock order, a table joined to itself is locked once
+func rlockTables(tables ...refTable) func() {
+	var ts []refTable
+	for _, t := range tables {
+		dup := false
+		for _, o := range ts {
+			dup = dup || o == t
+		}
+		if !dup {
+			ts = append(ts, t)
+		}
+	}
+	ts = sortTables(ts)
+	for _, t := range ts {
+		t.rlock()
+	}
+	return func() {
+		for i := len(ts) - 1; i >= 0; i-- {
+			ts[i].runlock()
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package rdblite
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_join(t *testing.T) {
+	customers := &Table[Customerdata]{}
+	invoices := &Table[Invoicedata]{}
+	defer customers.stopTimer()
+	defer invoices.stopTimer()
+
+	alice, _ := customers.Insert(Customerdata{Name: "alice"})
+	bob, _ := customers.Insert(Customerdata{Name: "bob"})
+	customers.Insert(Customerdata{Name: "carol"})
+	invoices.Insert(Invoicedata{CustomerID: alice, Amount: 1})
+	invoices.Insert(Invoicedata{CustomerID: bob, Amount: 2})
+	invoices.Insert(Invoicedata{CustomerID: alice, Amount: 3})
+	invoices.Insert(Invoicedata{CustomerID: 99, Amount: 4})
+
+	// invoices to their customer
+	byID := func(r Invoicedata) int { return r.CustomerID }
+	pairs := JoinByID(invoices, nil, byID, customers)
+	if len(pairs) != 3 || pairs[0].Right.Name != "alice" || pairs[1].Right.Name != "bob" {
+		t.Error("join by id failed", pairs)
+	}
+	pairs = LeftJoinByID(invoices, func(r Invoicedata) bool { return r.Amount > 1 }, byID, customers)
+	if len(pairs) != 3 || pairs[2].Left.Amount != 4 || pairs[2].Right != nil {
+		t.Error("left join by id failed", pairs)
+	}
+
+	// customers to their invoices, with and without an index
+	onID := func(r Customerdata) any { return r.ID }
+	for i := 0; i < 2; i++ {
+		rows, e := JoinOn(customers, nil, onID, invoices, "CustomerID")
+		if e != nil {
+			t.Fatal(e)
+		}
+		if len(rows) != 3 || rows[0].Right.Amount != 1 || rows[1].Right.Amount != 3 || rows[2].Left.Name != "bob" {
+			t.Error("join on failed", rows)
+		}
+		rows, _ = LeftJoinOn(customers, nil, onID, invoices, "CustomerID")
+		if len(rows) != 4 || rows[3].Left.Name != "carol" || rows[3].Right != nil {
+			t.Error("left join on failed", rows)
+		}
+		invoices.CreateIndex("CustomerID")
+	}
+
+	if _, e := JoinOn(customers, nil, onID, invoices, "Missing"); e == nil {
+		t.Error("expected error for unknown field")
+	}
+	if _, e := JoinOn(customers, nil, func(r Customerdata) any { return r.Name }, invoices, "CustomerID"); e == nil {
+		t.Error("expected error for key type")
+	}
+
+	// self join
+	self := JoinByID(customers, nil, func(r Customerdata) int { return r.ID }, customers)
+	if len(self) != 3 {
+		t.Error("self join failed", len(self))
+	}
+}
+
+func Test_join_lock_order(t *testing.T) {
+	customers := &Table[Customerdata]{}
+	invoices := &Table[Invoicedata]{}
+	defer customers.stopTimer()
+	defer invoices.stopTimer()
+	c, _ := customers.Insert(Customerdata{Name: "alice"})
+	i, _ := invoices.Insert(Invoicedata{CustomerID: c})
+
+	// standalone tables are locked in the same order whatever the argument order
+	ab := sortTables([]refTable{customers, invoices})
+	ba := sortTables([]refTable{invoices, customers})
+	if ab[0] != ba[0] {
+		t.Error("lock order depends on the argument order")
+	}
+
+	// joins in both directions with writers on both tables
+	byID := func(r Invoicedata) int { return r.CustomerID }
+	back := func(r Customerdata) int { return r.ID }
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, fn := range []func(){
+		func() { JoinByID(invoices, nil, byID, customers) },
+		func() { JoinByID(customers, nil, back, invoices) },
+		func() { customers.UpdateFunc(c, func(r *Customerdata) { r.Name += "x" }) },
+		func() { invoices.UpdateFunc(i, func(r *Invoicedata) { r.Amount++ }) },
+	} {
+		wg.Add(1)
+		go func(fn func()) {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				fn()
+			}
+		}(fn)
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("joins deadlocked")
+	}
+}
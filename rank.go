@@ -0,0 +1,160 @@
+package rdblite
+
+import (
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// SearchResult is a row returned by SearchRanked with its score and what matched
+type SearchResult[T any] struct {
+	Row     T
+	Score   float64
+	Matches []SearchMatch
+}
+
+// SearchMatch is a search term found in a field of a row
+type SearchMatch struct {
+	Field string
+	Term  string
+	Count int  // times the term is in the field
+	Exact bool // the term is a whole word in the field
+}
+
+type rankTerm struct {
+	term  string
+	field string // only score this field for field:term
+}
+
+// SetFieldWeight sets the score multiplier for matches in a field for SearchRanked(), default 1.
+// Can also be set with the `rdb:"weight=2"` struct tag
+func (t *Table[T]) SetFieldWeight(fieldname string, weight float64) error {
+	f, e := lookupField[T](fieldname)
+	if e != nil {
+		return e
+	}
+	t.m.Lock()
+	defer t.m.Unlock()
+	if t.weights == nil {
+		t.weights = make(map[string]float64)
+	}
+	t.weights[f.name] = weight
+	return nil
+}
+
+// SearchRanked like Search but ordered by score with the best first.
+// The score is the weighted count of the terms in each field, whole word matches count double
+func (t *Table[T]) SearchRanked(str string) []SearchResult[T] {
+	start := time.Now()
+	type weighted struct {
+		field
+		weight float64
+	}
+	var fields []weighted
+
+	// fields for the weights without starting the table like CreateIndex
+	t.m.Lock()
+	t.setup()
+	t.m.Unlock()
+	t.m.RLock()
+	for _, f := range t.fields {
+		if !f.search {
+			continue
+		}
+		w := 1.0
+		if s, ok := f.option("weight"); ok {
+			if v, e := strconv.ParseFloat(s, 64); e == nil {
+				w = v
+			}
+		}
+		if v, ok := t.weights[f.name]; ok {
+			w = v
+		}
+		fields = append(fields, weighted{field: f, weight: w})
+	}
+
+	node := parseSearch[T](str, t.fulltext, t.fields)
+	terms := rankTerms(node, nil)
+	var data []SearchResult[T]
+	for _, r := range t.matchRows(node) {
+		res := SearchResult[T]{Row: *r}
+		for _, f := range fields {
+			text := f.text(r)
+			for _, rt := range terms {
+				if rt.field != "" && rt.field != f.name {
+					continue
+				}
+				count, exact := countTerm(text, rt.term)
+				if count == 0 {
+					continue
+				}
+				res.Score += f.weight * float64(count+exact)
+				res.Matches = append(res.Matches, SearchMatch{
+					Field: f.name,
+					Term:  rt.term,
+					Count: count,
+					Exact: exact > 0,
+				})
+			}
+		}
+		data = append(data, res)
+	}
+	t.m.RUnlock()
+
+	sort.SliceStable(data, func(i, j int) bool {
+		return data[i].Score > data[j].Score
+	})
+	log.Println("search ranked time =", time.Since(start))
+	return data
+}
+
+// rankTerms collects the terms a row must contain, terms under a NOT are skipped
+func rankTerms[T tableInterface](node searchNode[T], terms []rankTerm) []rankTerm {
+	switch n := node.(type) {
+	case termNode[T]:
+		terms = append(terms, rankTerm{term: n.term})
+	case wordNode[T]:
+		terms = append(terms, rankTerm{term: n.term})
+	case fieldNode[T]:
+		terms = append(terms, rankTerm{term: n.term, field: n.field.name})
+	case andNode[T]:
+		for _, c := range n.nodes {
+			terms = rankTerms(c, terms)
+		}
+	case orNode[T]:
+		for _, c := range n.nodes {
+			terms = rankTerms(c, terms)
+		}
+	}
+	return terms
+}
+
+// countTerm returns the number of times term is in text and how many of those are whole words
+func countTerm(text, term string) (int, int) {
+	count, exact := 0, 0
+	for i := 0; ; {
+		p := strings.Index(text[i:], term)
+		if p < 0 {
+			break
+		}
+		s := i + p
+		end := s + len(term)
+		count++
+		if isBoundary(text, s-1) && isBoundary(text, end) {
+			exact++
+		}
+		i = end
+	}
+	return count, exact
+}
+
+func isBoundary(text string, i int) bool {
+	if i < 0 || i >= len(text) {
+		return true
+	}
+	c := rune(text[i])
+	return c < 0x80 && !unicode.IsLetter(c) && !unicode.IsDigit(c)
+}
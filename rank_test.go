@@ -0,0 +1,55 @@
+package rdblite
+
+import (
+	"testing"
+)
+
+type Rankdata struct {
+	BaseTable
+	Title string `rdb:"weight=3"`
+	Body  string
+}
+
+func Test_search_ranked(t *testing.T) {
+	tt := &Table[Rankdata]{
+		GobFilename: "test/rank.gob",
+	}
+	tt.AddUpdate(Rankdata{Title: "cooking", Body: "a book about go and golang"})
+	tt.AddUpdate(Rankdata{Title: "go programming", Body: "learn go"})
+	tt.AddUpdate(Rankdata{Title: "gardening", Body: "going outside"})
+	tt.AddUpdate(Rankdata{Title: "nothing", Body: "here"})
+	tt.stopTimer()
+
+	res := tt.SearchRanked("go")
+	if len(res) != 3 {
+		t.Fatal("expected 3 results got", len(res))
+	}
+	// title weight 3 and whole words first
+	if res[0].Row.ID != 2 || res[1].Row.ID != 1 || res[2].Row.ID != 3 {
+		t.Error("wrong order", res)
+	}
+	if len(res[0].Matches) != 2 || res[0].Matches[0].Field != "Title" || !res[0].Matches[0].Exact {
+		t.Error("wrong matches", res[0].Matches)
+	}
+	if res[2].Matches[0].Exact {
+		t.Error("going is not an exact match for go")
+	}
+
+	// field weights can be changed
+	tt.SetFieldWeight("Body", 10)
+	res = tt.SearchRanked("go -programming")
+	if len(res) != 2 || res[0].Row.ID != 1 {
+		t.Error("wrong order with body weight", res)
+	}
+
+	res = tt.SearchRanked("title:go")
+	if len(res) != 1 || len(res[0].Matches) != 1 || res[0].Matches[0].Field != "Title" {
+		t.Error("field term should only match the field", res)
+	}
+
+	// a read does not start the table
+	t2 := &Table[Rankdata]{}
+	if res = t2.SearchRanked("go"); len(res) != 0 || t2.stimer != nil {
+		t.Error("search started the save timer")
+	}
+}
@@ -0,0 +1,344 @@
+package rdblite
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync/atomic"
+
+	"github.com/mgholam/rdblite/storagefile"
+)
+
+// OnDelete is what happens to referencing rows when the referenced row is deleted
+type OnDelete int
+
+const (
+	Restrict OnDelete = iota // the delete fails while rows reference it
+	Cascade                  // referencing rows are deleted
+	SetZero                  // the referencing field is set to 0
+)
+
+// ErrMissingReference is returned when a written row references an ID not in the referenced table
+type ErrMissingReference struct {
+	Field string
+	ID    int // row being written
+	RefID int // ID not found
+}
+
+func (e *ErrMissingReference) Error() string {
+	return fmt.Sprintf("field %s of row %d references missing id %d", e.Field, e.ID, e.RefID)
+}
+
+// ErrRestrictedDelete is returned when deleting a row that is referenced with Restrict
+type ErrRestrictedDelete struct {
+	Field   string // referencing field
+	ID      int    // row being deleted
+	ChildID int    // row referencing it
+}
+
+func (e *ErrRestrictedDelete) Error() string {
+	return fmt.Sprintf("row %d is referenced by field %s of row %d", e.ID, e.Field, e.ChildID)
+}
+
+// reference from a field of this table to the ID of the parent table
+type reference struct {
+	field  field
+	parent refTable
+}
+
+// referrer is a field of the child table referencing the ID of this table
+type referrer struct {
+	field    field
+	child    refTable
+	onDelete OnDelete
+}
+
+// pendingFunc returns the uncommitted row for an ID in a transaction, nil for a delete
+type pendingFunc func(t refTable, id int) (r any, ok bool)
+
+// refTable is a Table[T] that can be locked together with other tables
+type refTable interface {
+	lock()
+	unlock()
+	rlock()
+	runlock()
+	lockKey() (depth int, seq int)
+	parentTables() []refTable
+	childTables() []refTable
+	// callers must hold the lock
+	exists(id int) bool
+	referencing(f field, id int) []int
+	checkDelete(id int, pending pendingFunc) error
+	cascadeTx() txMember
+	logFile() (*storagefile.StorageFile, error)
+	// call without the lock
+	autoSave()
+	autoSaveChildren()
+}
+
+var tableSeq int64
+
+// References declares that fieldname of child holds the ID of a parent row, 0 for none.
+// Writes to child with an ID not in parent fail with *ErrMissingReference and deleting a parent row
+// does onDelete to the child rows. The field is indexed.
+// * call before using the tables, like FullTextIndex
+func References[C, P tableInterface](child *Table[C], fieldname string, parent *Table[P], onDelete OnDelete) error {
+	f, e := lookupField[C](fieldname)
+	if e != nil {
+		return e
+	}
+	switch f.typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	default:
+		return fmt.Errorf("field %s of type %s can not reference an id", f.name, f.typ)
+	}
+	if dependsOn(parent, child) {
+		return fmt.Errorf("field %s would make a reference cycle", f.name)
+	}
+	if e = child.CreateIndex(f.name); e != nil {
+		return e
+	}
+	child.m.Lock()
+	child.setSeq()
+	child.refs = append(child.refs, reference{field: f, parent: parent})
+	child.m.Unlock()
+
+	parent.m.Lock()
+	parent.setSeq()
+	parent.referrers = append(parent.referrers, referrer{field: f, child: child, onDelete: onDelete})
+	parent.m.Unlock()
+	return nil
+}
+
+// dependsOn is true if t is or references other directly or through its parents
+func dependsOn(t, other refTable) bool {
+	if t == other {
+		return true
+	}
+	for _, p := range t.parentTables() {
+		if dependsOn(p, other) {
+			return true
+		}
+	}
+	return false
+}
+
+// setSeq gives the table its place in the lock order once, safe without the lock
+func (t *Table[T]) setSeq() {
+	if atomic.LoadInt64(&t.seq) == 0 {
+		atomic.CompareAndSwapInt64(&t.seq, 0, atomic.AddInt64(&tableSeq, 1))
+	}
+}
+
+// lockKey orders tables so parents are locked before their children,
+// tables without a place in the lock order get one so every table is ordered
+func (t *Table[T]) lockKey() (int, int) {
+	t.setSeq()
+	depth := 0
+	for _, p := range t.parentTables() {
+		if d, _ := p.lockKey(); d+1 > depth {
+			depth = d + 1
+		}
+	}
+	return depth, int(atomic.LoadInt64(&t.seq))
+}
+
+func (t *Table[T]) parentTables() []refTable {
+	var ts []refTable
+	for _, r := range t.refs {
+		ts = append(ts, r.parent)
+	}
+	return ts
+}
+
+func (t *Table[T]) childTables() []refTable {
+	var ts []refTable
+	for _, r := range t.referrers {
+		ts = append(ts, r.child)
+	}
+	return ts
+}
+
+// sortTables in lock order
+func sortTables[R refTable](ts []R) []R {
+	sorted := append([]R{}, ts...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		di, si := sorted[i].lockKey()
+		dj, sj := sorted[j].lockKey()
+		if di != dj {
+			return di < dj
+		}
+		return si < sj
+	})
+	return sorted
+}
+
+// lockTables write locks tables, and all tables below them if deleting for cascades,
+// and read locks their parents for reference checks. Returns the unlock function
+func lockTables(tables []refTable, deleting bool) func() {
+	write := make(map[refTable]bool)
+	var all []refTable
+	var add func(t refTable, w bool)
+	add = func(t refTable, w bool) {
+		if cur, ok := write[t]; ok {
+			if w && !cur {
+				write[t] = true
+			}
+			return
+		}
+		write[t] = w
+		all = append(all, t)
+	}
+	var below func(t refTable)
+	below = func(t refTable) {
+		for _, c := range t.childTables() {
+			add(c, true)
+			below(c)
+		}
+	}
+	for _, t := range tables {
+		add(t, true)
+		if deleting {
+			below(t)
+		}
+	}
+	for _, t := range append([]refTable{}, all...) {
+		for _, p := range t.parentTables() {
+			add(p, false)
+		}
+	}
+	all = sortTables(all)
+	for _, t := range all {
+		if write[t] {
+			t.lock()
+		} else {
+			t.rlock()
+		}
+	}
+	return func() {
+		for i := len(all) - 1; i >= 0; i-- {
+			if write[all[i]] {
+				all[i].unlock()
+			} else {
+				all[i].runlock()
+			}
+		}
+	}
+}
+
+// writeLock locks the table for a write with the tables it references, returns the unlock function
+func (t *Table[T]) writeLock(deleting bool) func() {
+	if len(t.refs) == 0 && (!deleting || len(t.referrers) == 0) {
+		t.m.Lock()
+		return t.m.Unlock
+	}
+	return lockTables([]refTable{t}, deleting)
+}
+
+func refID(v reflect.Value) int {
+	switch v.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(v.Uint())
+	}
+	return int(v.Int())
+}
+
+// checkRefs checks the row only references existing parent rows, callers must hold the locks
+func (t *Table[T]) checkRefs(r *T, pending pendingFunc) error {
+	for _, ref := range t.refs {
+		id := refID(ref.field.value(r))
+		if id == 0 {
+			continue
+		}
+		if pending != nil {
+			if p, ok := pending(ref.parent, id); ok {
+				if p != nil {
+					continue
+				}
+				return &ErrMissingReference{Field: ref.field.name, ID: (*r).getID(), RefID: id}
+			}
+		}
+		if !ref.parent.exists(id) {
+			return &ErrMissingReference{Field: ref.field.name, ID: (*r).getID(), RefID: id}
+		}
+	}
+	return nil
+}
+
+func (t *Table[T]) exists(id int) bool {
+	found, _ := t.findIndex(id)
+	return found
+}
+
+// referencing returns the IDs of rows where the field is id
+func (t *Table[T]) referencing(f field, id int) []int {
+	var ids []int
+	if ix, ok := t.indexes[f.name]; ok {
+		key := reflect.ValueOf(id).Convert(f.typ).Interface()
+		for cid := range ix.values[key] {
+			ids = append(ids, cid)
+		}
+		sort.Ints(ids)
+		return ids
+	}
+	for _, r := range t.rows {
+		if refID(f.value(r)) == id {
+			ids = append(ids, (*r).getID())
+		}
+	}
+	return ids
+}
+
+// checkDelete returns *ErrRestrictedDelete if deleting id is restricted by this or any cascaded table,
+// rows changed in a transaction are checked with their pending value. Callers must hold the locks
+func (t *Table[T]) checkDelete(id int, pending pendingFunc) error {
+	for _, rf := range t.referrers {
+		if rf.onDelete == SetZero {
+			continue
+		}
+		for _, cid := range rf.child.referencing(rf.field, id) {
+			if pending != nil {
+				if r, ok := pending(rf.child, cid); ok && (r == nil || refID(rf.field.value(r)) != id) {
+					continue
+				}
+			}
+			if rf.onDelete == Restrict {
+				return &ErrRestrictedDelete{Field: rf.field.name, ID: id, ChildID: cid}
+			}
+			if e := rf.child.checkDelete(cid, pending); e != nil {
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+// cascade adds deleting or setting zero the rows referencing id to the child transactions in the set,
+// callers must hold the locks
+func (t *Table[T]) cascade(id int, s *txSet) {
+	for _, rf := range t.referrers {
+		if rf.onDelete == Restrict {
+			continue
+		}
+		for _, cid := range rf.child.referencing(rf.field, id) {
+			s.member(rf.child).cascade(cid, rf.field, id, rf.onDelete)
+		}
+	}
+}
+
+// autoSaveChildren after a delete cascaded to them
+func (t *Table[T]) autoSaveChildren() {
+	for _, c := range t.childTables() {
+		c.autoSave()
+	}
+}
+
+// cascadeTx is a transaction for the changes cascaded to the table
+func (t *Table[T]) cascadeTx() txMember {
+	return t.newTx()
+}
+
+func (t *Table[T]) logFile() (*storagefile.StorageFile, error) {
+	return t.wal, t.walErr
+}
@@ -0,0 +1,200 @@
+package rdblite
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"testing"
+)
+
+type Invoicedata struct {
+	BaseTable
+	CustomerID int
+	Amount     int
+}
+
+type Linedata struct {
+	BaseTable
+	InvoiceID uint
+	Item      string
+}
+
+func Test_references(t *testing.T) {
+	customers := &Table[Customerdata]{}
+	invoices := &Table[Invoicedata]{}
+	lines := &Table[Linedata]{}
+	defer customers.stopTimer()
+	defer invoices.stopTimer()
+	defer lines.stopTimer()
+
+	if e := References(invoices, "CustomerID", customers, Restrict); e != nil {
+		t.Fatal(e)
+	}
+	if e := References(lines, "InvoiceID", invoices, Cascade); e != nil {
+		t.Fatal(e)
+	}
+	if e := References(customers, "ID", lines, Cascade); e == nil {
+		t.Error("expected error for a reference cycle")
+	}
+	if e := References(lines, "Item", invoices, Cascade); e == nil {
+		t.Error("expected error for a string field")
+	}
+
+	c, _ := customers.Insert(Customerdata{Name: "alice"})
+	_, e := invoices.Insert(Invoicedata{CustomerID: 99})
+	var me *ErrMissingReference
+	if !errors.As(e, &me) || me.Field != "CustomerID" || me.RefID != 99 {
+		t.Error("expected missing reference got", e)
+	}
+	if _, e = invoices.Insert(Invoicedata{}); e != nil {
+		t.Error("0 is no reference", e)
+	}
+	inv, _ := invoices.Insert(Invoicedata{CustomerID: c, Amount: 10})
+	lines.Insert(Linedata{InvoiceID: uint(inv), Item: "a"})
+	lines.Insert(Linedata{InvoiceID: uint(inv), Item: "b"})
+	if e = invoices.Patch(inv, map[string]any{"CustomerID": 5}); !errors.As(e, &me) {
+		t.Error("expected missing reference for patch got", e)
+	}
+
+	var re *ErrRestrictedDelete
+	if e = customers.Delete(c); !errors.As(e, &re) || re.ID != c || re.ChildID != inv {
+		t.Error("expected restricted delete got", e)
+	}
+	if e = invoices.Delete(inv); e != nil {
+		t.Fatal(e)
+	}
+	if lines.TotalRows() != 0 {
+		t.Error("cascade delete failed", lines.TotalRows())
+	}
+	if e = customers.Delete(c); e != nil {
+		t.Error(e)
+	}
+
+	// a restrict below a cascade fails the whole delete
+	notes := &Table[Linedata]{}
+	defer notes.stopTimer()
+	References(notes, "InvoiceID", invoices, Restrict)
+	inv, _ = invoices.Insert(Invoicedata{Amount: 1})
+	lines.Insert(Linedata{InvoiceID: uint(inv)})
+	notes.Insert(Linedata{InvoiceID: uint(inv)})
+	if e = invoices.Delete(inv); !errors.As(e, &re) {
+		t.Error("expected restricted delete got", e)
+	}
+	if lines.TotalRows() != 1 || invoices.TotalRows() != 2 {
+		t.Error("failed delete changed rows", lines.TotalRows(), invoices.TotalRows())
+	}
+
+	// set zero
+	owners := &Table[Customerdata]{}
+	defer owners.stopTimer()
+	References(invoices, "Amount", owners, SetZero)
+	o, _ := owners.Insert(Customerdata{Name: "bob"})
+	invoices.UpdateFunc(inv, func(r *Invoicedata) { r.Amount = o })
+	if e = owners.Delete(o); e != nil {
+		t.Fatal(e)
+	}
+	if _, r := invoices.FindByID(inv); r.Amount != 0 || r.Version != 3 {
+		t.Error("set zero failed", r)
+	}
+
+	// transactions see the other checks
+	tx := invoices.Begin()
+	tx.Delete(inv)
+	if e = tx.Commit(); !errors.As(e, &re) {
+		t.Error("expected restricted delete in transaction got", e)
+	}
+	ltx := lines.Begin()
+	ltx.AddUpdate(Linedata{InvoiceID: 1000})
+	if e = ltx.Commit(); !errors.As(e, &me) {
+		t.Error("expected missing reference in transaction got", e)
+	}
+}
+
+func Test_references_database(t *testing.T) {
+	os.RemoveAll("test/dbref")
+	db, _ := OpenDatabase("test/dbref")
+	db.WAL = true
+	invoices, _ := Register[Invoicedata](db, "invoices")
+	customers, _ := Register[Customerdata](db, "customers")
+	References(invoices, "CustomerID", customers, Restrict)
+	if e := db.Load(); e != nil {
+		t.Fatal(e)
+	}
+
+	// the parent is inserted in the same transaction
+	dtx := db.Begin()
+	itx, _ := TxFor(dtx, invoices)
+	ctx, _ := TxFor(dtx, customers)
+	c, _ := ctx.AddUpdate(Customerdata{Name: "alice"})
+	inv, _ := itx.AddUpdate(Invoicedata{CustomerID: c})
+	if e := dtx.Commit(); e != nil {
+		t.Fatal(e)
+	}
+
+	// the parent is deleted in the same transaction as its children
+	dtx = db.Begin()
+	ctx, _ = TxFor(dtx, customers)
+	ctx.Delete(c)
+	if e := dtx.Commit(); e == nil {
+		t.Error("expected restricted delete")
+	}
+	dtx = db.Begin()
+	ctx, _ = TxFor(dtx, customers)
+	itx, _ = TxFor(dtx, invoices)
+	ctx.Delete(c)
+	itx.Delete(inv)
+	if e := dtx.Commit(); e != nil {
+		t.Error(e)
+	}
+	if invoices.TotalRows() != 0 || customers.TotalRows() != 0 {
+		t.Error("delete failed", invoices.TotalRows(), customers.TotalRows())
+	}
+
+	// no deadlocks between child writes, cascades and database saves
+	References(invoices, "Amount", customers, Cascade)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				id, _ := customers.Insert(Customerdata{Name: "x"})
+				invoices.Insert(Invoicedata{CustomerID: 0, Amount: id})
+				customers.Delete(id)
+				if j%10 == 0 {
+					db.Save()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if invoices.TotalRows() != 0 {
+		t.Error("cascade failed", invoices.TotalRows())
+	}
+
+	// cascades are undone when another member fails
+	c, _ = customers.Insert(Customerdata{Name: "bob"})
+	invoices.Insert(Invoicedata{Amount: c})
+	invoices.Insert(Invoicedata{Amount: c})
+	dtx = db.Begin()
+	ctx, _ = TxFor(dtx, customers)
+	itx, _ = TxFor(dtx, invoices)
+	ctx.Delete(c)
+	itx.AddUpdate(Invoicedata{Amount: 12345})
+	if e := dtx.Commit(); e == nil {
+		t.Error("expected missing reference")
+	}
+	if customers.TotalRows() != 1 || invoices.TotalRows() != 2 {
+		t.Error("failed commit changed the tables", customers.TotalRows(), invoices.TotalRows())
+	}
+
+	// the cascade and the delete are one journal entry
+	count := db.journal.Count()
+	if e := customers.Delete(c); e != nil {
+		t.Fatal(e)
+	}
+	if db.journal.Count() != count+1 || invoices.TotalRows() != 0 {
+		t.Error("expected one journal entry", db.journal.Count()-count, invoices.TotalRows())
+	}
+	db.Close()
+}
@@ -0,0 +1,117 @@
+package rdblite
+
+import (
+	"log"
+	"time"
+)
+
+// SaveMode for when a table is saved to its gob file
+type SaveMode int
+
+const (
+	SaveInterval     SaveMode = iota // save every SavePolicy.Interval if there are changes, the default
+	SaveAfterChanges                 // save after SavePolicy.Changes changes and every Interval if set
+	SaveOnWrite                      // save after every AddUpdate() and Delete()
+	SaveManual                       // only save on SaveGob() and Close()
+)
+
+// SavePolicy for a table, the zero value saves every SAVE_TIMER seconds
+type SavePolicy struct {
+	Mode     SaveMode
+	Interval time.Duration // for SaveInterval default SAVE_TIMER seconds
+	Changes  int           // for SaveAfterChanges
+	OnSave   func(SaveResult)
+}
+
+// SaveResult is passed to SavePolicy.OnSave after every save
+type SaveResult struct {
+	Filename string
+	Rows     int
+	Duration time.Duration
+	Err      error
+}
+
+// interval for the save timer, 0 for no timer
+func (p SavePolicy) interval() time.Duration {
+	switch p.Mode {
+	case SaveInterval:
+		if p.Interval <= 0 {
+			return SAVE_TIMER * time.Second
+		}
+		return p.Interval
+	case SaveAfterChanges:
+		return p.Interval
+	}
+	return 0
+}
+
+// startTimer for the save policy
+func (t *Table[T]) startTimer() {
+	d := t.SavePolicy.interval()
+	if d <= 0 {
+		return
+	}
+	log.Println("save timer started...")
+	t.stimer = time.NewTicker(d)
+	t.done = make(chan struct{})
+	go func(ticker *time.Ticker, done chan struct{}) {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			t.m.RLock()
+			dirty := t.isDirty
+			t.m.RUnlock()
+			if dirty {
+				log.Println("--- timer save ---")
+				if e := t.SaveGob(); e != nil {
+					log.Println("timer save error", e)
+				}
+			}
+		}
+	}(t.stimer, t.done)
+}
+
+// stopTimer and its goroutine
+func (t *Table[T]) stopTimer() {
+	t.m.Lock()
+	defer t.m.Unlock()
+	if t.stimer != nil {
+		t.stimer.Stop()
+		close(t.done)
+		t.stimer = nil
+	}
+}
+
+// autoSave after a write if the save policy needs it, call without the lock
+func (t *Table[T]) autoSave() {
+	t.m.Lock()
+	save := false
+	switch t.SavePolicy.Mode {
+	case SaveOnWrite:
+		save = t.isDirty
+	case SaveAfterChanges:
+		save = t.isDirty && t.SavePolicy.Changes > 0 && t.changes >= t.SavePolicy.Changes
+	}
+	t.m.Unlock()
+	if save {
+		if e := t.SaveGob(); e != nil {
+			log.Println("auto save error", e)
+		}
+	}
+}
+
+// onSave reports the save to the policy hook
+func (t *Table[T]) onSave(rows int, start time.Time, e error) {
+	if t.SavePolicy.OnSave == nil {
+		return
+	}
+	t.SavePolicy.OnSave(SaveResult{
+		Filename: t.GobFilename,
+		Rows:     rows,
+		Duration: time.Since(start),
+		Err:      e,
+	})
+}
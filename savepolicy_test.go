@@ -0,0 +1,84 @@
+package rdblite
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_save_policy(t *testing.T) {
+	createTest()
+
+	var m sync.Mutex
+	saves := 0
+	onsave := func(r SaveResult) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+		m.Lock()
+		saves++
+		m.Unlock()
+	}
+	reset := func() {
+		m.Lock()
+		saves = 0
+		m.Unlock()
+	}
+	count := func() int {
+		m.Lock()
+		defer m.Unlock()
+		return saves
+	}
+
+	tt := Table[Testdata]{
+		GobFilename: "test/test.gob",
+		SavePolicy:  SavePolicy{Mode: SaveOnWrite, OnSave: onsave},
+	}
+	tt.LoadGob()
+	tt.AddUpdate(Testdata{Name: "a"})
+	tt.Delete(1)
+	if count() != 2 {
+		t.Error("on write expected 2 saves got", count())
+	}
+
+	reset()
+	tt = Table[Testdata]{
+		GobFilename: "test/test.gob",
+		SavePolicy:  SavePolicy{Mode: SaveAfterChanges, Changes: 3, OnSave: onsave},
+	}
+	tt.LoadGob()
+	for i := 0; i < 7; i++ {
+		tt.AddUpdate(Testdata{Name: "a"})
+	}
+	if count() != 2 {
+		t.Error("after 3 changes expected 2 saves got", count())
+	}
+
+	reset()
+	tt = Table[Testdata]{
+		GobFilename: "test/test.gob",
+		SavePolicy:  SavePolicy{Mode: SaveManual, OnSave: onsave},
+	}
+	tt.LoadGob()
+	tt.AddUpdate(Testdata{Name: "a"})
+	if count() != 0 || tt.stimer != nil {
+		t.Error("manual should not save")
+	}
+	tt.Close()
+	if count() != 1 {
+		t.Error("close should save")
+	}
+
+	reset()
+	tt = Table[Testdata]{
+		GobFilename: "test/test.gob",
+		SavePolicy:  SavePolicy{Interval: 20 * time.Millisecond, OnSave: onsave},
+	}
+	tt.LoadGob()
+	tt.AddUpdate(Testdata{Name: "a"})
+	time.Sleep(100 * time.Millisecond)
+	if count() != 1 {
+		t.Error("interval expected 1 save got", count())
+	}
+	tt.Close()
+}
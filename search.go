@@ -0,0 +1,294 @@
+package rdblite
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Search query grammar :
+//
+//	alice bob          rows containing alice AND bob
+//	alice OR bob       rows containing alice or bob
+//	-bob               rows not containing bob
+//	"alice smith"      rows containing the exact phrase
+//	(alice OR bob) tom grouping
+//	Status:open        rows where the Status field contains open
+
+type searchNode[T tableInterface] interface {
+	match(r *T) bool
+}
+
+type termNode[T tableInterface] struct {
+	term string
+}
+
+func (n termNode[T]) match(r *T) bool {
+	return (*r).contains(n.term)
+}
+
+type fieldNode[T tableInterface] struct {
+	field field
+	term  string
+}
+
+func (n fieldNode[T]) match(r *T) bool {
+	return strings.Contains(n.field.text(r), n.term)
+}
+
+type notNode[T tableInterface] struct {
+	node searchNode[T]
+}
+
+func (n notNode[T]) match(r *T) bool {
+	return !n.node.match(r)
+}
+
+type andNode[T tableInterface] struct {
+	nodes []searchNode[T]
+}
+
+func (n andNode[T]) match(r *T) bool {
+	for _, c := range n.nodes {
+		if !c.match(r) {
+			return false
+		}
+	}
+	return true
+}
+
+type orNode[T tableInterface] struct {
+	nodes []searchNode[T]
+}
+
+func (n orNode[T]) match(r *T) bool {
+	for _, c := range n.nodes {
+		if c.match(r) {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	tokWord = iota
+	tokPhrase
+	tokField
+	tokNot
+	tokOr
+	tokOpen
+	tokClose
+)
+
+type searchToken struct {
+	kind  int
+	text  string
+	field string
+}
+
+// tokenize the search string, terms are lower cased to match rowstr
+func tokenize(str string) []searchToken {
+	var tokens []searchToken
+	rs := []rune(str)
+	i := 0
+	readPhrase := func() string {
+		// rs[i] == '"'
+		i++
+		s := i
+		for i < len(rs) && rs[i] != '"' {
+			i++
+		}
+		p := string(rs[s:i])
+		if i < len(rs) {
+			i++
+		}
+		return strings.ToLower(p)
+	}
+	for i < len(rs) {
+		c := rs[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, searchToken{kind: tokOpen})
+			i++
+		case c == ')':
+			tokens = append(tokens, searchToken{kind: tokClose})
+			i++
+		case c == '"':
+			tokens = append(tokens, searchToken{kind: tokPhrase, text: readPhrase()})
+		case c == '-' && i+1 < len(rs) && !unicode.IsSpace(rs[i+1]):
+			tokens = append(tokens, searchToken{kind: tokNot})
+			i++
+		default:
+			s := i
+			for i < len(rs) && !unicode.IsSpace(rs[i]) && rs[i] != '(' && rs[i] != ')' && rs[i] != '"' {
+				i++
+			}
+			w := string(rs[s:i])
+			if w == "OR" {
+				tokens = append(tokens, searchToken{kind: tokOr})
+				continue
+			}
+			if p := strings.Index(w, ":"); p > 0 {
+				name, value := w[:p], strings.ToLower(w[p+1:])
+				if value == "" && i < len(rs) && rs[i] == '"' {
+					value = readPhrase()
+				}
+				if value != "" {
+					tokens = append(tokens, searchToken{kind: tokField, field: name, text: value})
+					continue
+				}
+			}
+			tokens = append(tokens, searchToken{kind: tokWord, text: strings.ToLower(w)})
+		}
+	}
+	return tokens
+}
+
+type searchParser[T tableInterface] struct {
+	tokens []searchToken
+	pos    int
+	fields map[string]field
+	ix     *invertedIndex
+}
+
+// parseSearch builds the match tree for str, returns nil for an empty query.
+// With an inverted index terms match whole words otherwise any substring of rowstr
+func parseSearch[T tableInterface](str string, ix *invertedIndex, fields []field) searchNode[T] {
+	p := searchParser[T]{
+		tokens: tokenize(str),
+		fields: make(map[string]field),
+		ix:     ix,
+	}
+	for _, f := range fields {
+		p.fields[strings.ToLower(f.name)] = f
+	}
+	var node searchNode[T]
+	for p.pos < len(p.tokens) {
+		// skip unbalanced ')'
+		if n := p.parseOr(); n != nil {
+			if node == nil {
+				node = n
+			} else {
+				node = andNode[T]{nodes: []searchNode[T]{node, n}}
+			}
+		}
+		if p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokClose {
+			p.pos++
+		}
+	}
+	return node
+}
+
+func (p *searchParser[T]) parseOr() searchNode[T] {
+	var nodes []searchNode[T]
+	for {
+		if n := p.parseAnd(); n != nil {
+			nodes = append(nodes, n)
+		}
+		if p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokOr {
+			p.pos++
+			continue
+		}
+		break
+	}
+	switch len(nodes) {
+	case 0:
+		return nil
+	case 1:
+		return nodes[0]
+	}
+	return orNode[T]{nodes: nodes}
+}
+
+func (p *searchParser[T]) parseAnd() searchNode[T] {
+	var nodes []searchNode[T]
+	for p.pos < len(p.tokens) {
+		k := p.tokens[p.pos].kind
+		if k == tokOr || k == tokClose {
+			break
+		}
+		if n := p.parseUnary(); n != nil {
+			nodes = append(nodes, n)
+		}
+	}
+	switch len(nodes) {
+	case 0:
+		return nil
+	case 1:
+		return nodes[0]
+	}
+	return andNode[T]{nodes: nodes}
+}
+
+func (p *searchParser[T]) parseUnary() searchNode[T] {
+	tok := p.tokens[p.pos]
+	p.pos++
+	switch tok.kind {
+	case tokNot:
+		if p.pos >= len(p.tokens) {
+			return nil
+		}
+		k := p.tokens[p.pos].kind
+		if k == tokOr || k == tokClose {
+			return nil
+		}
+		if n := p.parseUnary(); n != nil {
+			return notNode[T]{node: n}
+		}
+		return nil
+	case tokOpen:
+		n := p.parseOr()
+		if p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokClose {
+			p.pos++
+		}
+		return n
+	case tokField:
+		if f, ok := p.fields[strings.ToLower(tok.field)]; ok {
+			return fieldNode[T]{field: f, term: tok.text}
+		}
+		// not a field so search for the whole text
+		return p.term(strings.ToLower(tok.field) + ":" + tok.text)
+	case tokWord, tokPhrase:
+		if tok.text == "" {
+			return nil
+		}
+		return p.term(tok.text)
+	}
+	return nil
+}
+
+func (p *searchParser[T]) term(str string) searchNode[T] {
+	if p.ix != nil {
+		if ws := words(str); len(ws) > 0 {
+			return wordNode[T]{ix: p.ix, words: ws, term: str}
+		}
+	}
+	return termNode[T]{term: str}
+}
+
+// SetFormatter sets the text used for a field in Search(), the rowstr of all rows is regenerated.
+// Fields in rowstr are set with the `rdb:"search"` and `rdb:"nosearch"` struct tags
+func (t *Table[T]) SetFormatter(fieldname string, format func(v any) string) error {
+	f, e := lookupField[T](fieldname)
+	if e != nil {
+		return e
+	}
+	t.m.Lock()
+	defer t.m.Unlock()
+	if t.formatters == nil {
+		t.formatters = make(map[string]func(v any) string)
+	}
+	t.formatters[f.name] = format
+	// regenerate fields and rowstr with the new formatter
+	t.fields = nil
+	t.setup()
+	t.genstrAll()
+	if t.fulltext != nil {
+		t.fulltext = newInvertedIndex()
+		for _, r := range t.rows {
+			t.fulltext.add((*r).getID(), (*r).text())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package rdblite
+
+import (
+	"testing"
+	"time"
+)
+
+type Searchdata struct {
+	BaseTable
+	Name   string
+	Status string
+	Note   string
+}
+
+func searchTable() *Table[Searchdata] {
+	tt := &Table[Searchdata]{
+		GobFilename: "test/search.gob",
+	}
+	tt.AddUpdate(Searchdata{Name: "Alice Smith", Status: "open", Note: "first order"})
+	tt.AddUpdate(Searchdata{Name: "Bob Jones", Status: "closed", Note: "alice referred"})
+	tt.AddUpdate(Searchdata{Name: "Carol Smith", Status: "open", Note: "smith family"})
+	tt.AddUpdate(Searchdata{Name: "Dave Brown", Status: "pending", Note: "open question"})
+	tt.stopTimer()
+	return tt
+}
+
+func ids(rows []Searchdata) []int {
+	var ids []int
+	for _, r := range rows {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+func Test_search_syntax(t *testing.T) {
+	tt := searchTable()
+
+	tests := []struct {
+		query string
+		ids   []int
+	}{
+		{"", []int{1, 2, 3, 4}},
+		{"smith", []int{1, 3}},
+		{"ALICE smith", []int{1}},
+		{"alice OR carol", []int{1, 2, 3}},
+		{"smith -carol", []int{1}},
+		{`"alice smith"`, []int{1}},
+		{`"smith alice"`, nil},
+		{"(bob OR dave) -brown", []int{2}},
+		{"status:open", []int{1, 3}},
+		{"Status:open -smith", nil},
+		{"status:open OR note:open", []int{1, 3, 4}},
+		{`note:"smith fam"`, []int{3}},
+		{"missing:open", nil},
+		{"(alice OR bob", []int{1, 2}},
+		{"alice) smith", []int{1}},
+	}
+	for _, tc := range tests {
+		got := ids(tt.Search(tc.query))
+		if len(got) != len(tc.ids) {
+			t.Errorf("%q expected %v got %v", tc.query, tc.ids, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.ids[i] {
+				t.Errorf("%q expected %v got %v", tc.query, tc.ids, got)
+				break
+			}
+		}
+	}
+}
+
+func Test_search_fulltext(t *testing.T) {
+	tt := &Table[Searchdata]{
+		GobFilename:   "test/search.gob",
+		FullTextIndex: true,
+	}
+	tt.AddUpdate(Searchdata{Name: "Alice Smith", Status: "open", Note: "first order"})
+	tt.AddUpdate(Searchdata{Name: "Bob Jones", Status: "closed", Note: "alice referred"})
+	tt.AddUpdate(Searchdata{Name: "Carol Smithers", Status: "open", Note: "smith-family"})
+	tt.stopTimer()
+
+	tests := []struct {
+		query string
+		ids   []int
+	}{
+		{"smith", []int{1, 3}},
+		{"smi", nil},
+		{"alice smith", []int{1}},
+		{"alice OR carol", []int{1, 2, 3}},
+		{"smith -carol", []int{1}},
+		{`"alice smith"`, []int{1}},
+		{`"smith alice"`, nil},
+		{"smith-family", []int{3}},
+		{"status:open alice", []int{1}},
+		{"-alice", []int{3}},
+	}
+	for _, tc := range tests {
+		got := ids(tt.Search(tc.query))
+		if len(got) != len(tc.ids) {
+			t.Errorf("%q expected %v got %v", tc.query, tc.ids, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.ids[i] {
+				t.Errorf("%q expected %v got %v", tc.query, tc.ids, got)
+				break
+			}
+		}
+	}
+
+	// partial words still work in substring mode
+	if got := ids(tt.SearchSubstring("smi")); len(got) != 2 {
+		t.Error("substring search expected 2 got", got)
+	}
+
+	// index follows updates and deletes
+	_, r := tt.FindByID(1)
+	r.Name = "Alice Walker"
+	tt.AddUpdate(r)
+	tt.Delete(3)
+	if got := ids(tt.Search("smith")); len(got) != 0 {
+		t.Error("expected no smith got", got)
+	}
+	if got := ids(tt.Search("walker")); len(got) != 1 {
+		t.Error("expected walker got", got)
+	}
+}
+
+type Fielddata struct {
+	BaseTable
+	Name     string
+	Code     string `rdb:"nosearch"`
+	Active   bool
+	Created  time.Time
+	Quantity float64
+}
+
+func Test_search_fields(t *testing.T) {
+	tt := &Table[Fielddata]{
+		GobFilename: "test/fields.gob",
+	}
+	created := time.Date(2022, 8, 9, 18, 21, 57, 0, time.UTC)
+	tt.AddUpdate(Fielddata{Name: "alice", Code: "x123", Active: true, Created: created, Quantity: 1.5})
+	tt.AddUpdate(Fielddata{Name: "bob", Code: "y456", Created: time.Now()})
+	tt.stopTimer()
+
+	_, r := tt.FindByID(1)
+	if r.rowstr != "alice 2022-08-09 18:21:57 1.5" {
+		t.Errorf("unexpected rowstr %q", r.rowstr)
+	}
+	if len(tt.Search("x123")) != 0 {
+		t.Error("nosearch field was searched")
+	}
+	if len(tt.Search("true")) != 0 {
+		t.Error("bool field was searched")
+	}
+	if len(tt.Search("0xc0")) != 0 || len(tt.Search("m=+")) != 0 {
+		t.Error("matched go formatting noise")
+	}
+	// field terms still work on excluded fields
+	if len(tt.Search("code:x123")) != 1 {
+		t.Error("field term on nosearch field failed")
+	}
+
+	tt.SetFormatter("Created", func(v any) string {
+		return v.(time.Time).Format("January 2006")
+	})
+	rows := tt.Search("august 2022")
+	if len(rows) != 1 || rows[0].ID != 1 {
+		t.Error("formatter not used", rows)
+	}
+}
+
+type Onlydata struct {
+	BaseTable
+	Name string `rdb:"search"`
+	Note string
+}
+
+func Test_search_only_tagged(t *testing.T) {
+	tt := &Table[Onlydata]{
+		GobFilename: "test/only.gob",
+	}
+	tt.AddUpdate(Onlydata{Name: "alice", Note: "bob"})
+	tt.stopTimer()
+	if len(tt.Search("alice")) != 1 || len(tt.Search("bob")) != 0 {
+		t.Error("only tagged fields should be searched")
+	}
+}
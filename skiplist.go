@@ -0,0 +1,111 @@
+package rdblite
+
+import (
+	"math/rand"
+	"reflect"
+)
+
+const (
+	maxLevel = 24
+)
+
+// skipList keeps (key, id) pairs ordered by key then id so duplicate keys are allowed
+type skipList struct {
+	head   *skipNode
+	level  int
+	length int
+	cmp    func(a, b reflect.Value) int
+	rnd    *rand.Rand
+}
+
+type skipNode struct {
+	key  reflect.Value
+	id   int
+	next []*skipNode
+}
+
+func newSkipList(cmp func(a, b reflect.Value) int) *skipList {
+	return &skipList{
+		head:  &skipNode{next: make([]*skipNode, maxLevel)},
+		level: 1,
+		cmp:   cmp,
+		rnd:   rand.New(rand.NewSource(1)),
+	}
+}
+
+// before is true if node n sorts before (key, id)
+func (s *skipList) before(n *skipNode, key reflect.Value, id int) bool {
+	c := s.cmp(n.key, key)
+	return c < 0 || (c == 0 && n.id < id)
+}
+
+func (s *skipList) randomLevel() int {
+	lvl := 1
+	for lvl < maxLevel && s.rnd.Intn(4) == 0 {
+		lvl++
+	}
+	return lvl
+}
+
+func (s *skipList) insert(key reflect.Value, id int) {
+	var update [maxLevel]*skipNode
+	x := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && s.before(x.next[i], key, id) {
+			x = x.next[i]
+		}
+		update[i] = x
+	}
+	lvl := s.randomLevel()
+	if lvl > s.level {
+		for i := s.level; i < lvl; i++ {
+			update[i] = s.head
+		}
+		s.level = lvl
+	}
+	n := &skipNode{key: key, id: id, next: make([]*skipNode, lvl)}
+	for i := 0; i < lvl; i++ {
+		n.next[i] = update[i].next[i]
+		update[i].next[i] = n
+	}
+	s.length++
+}
+
+func (s *skipList) remove(key reflect.Value, id int) {
+	var update [maxLevel]*skipNode
+	x := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && s.before(x.next[i], key, id) {
+			x = x.next[i]
+		}
+		update[i] = x
+	}
+	x = x.next[0]
+	if x == nil || x.id != id || s.cmp(x.key, key) != 0 {
+		return
+	}
+	for i := 0; i < s.level; i++ {
+		if update[i].next[i] != x {
+			break
+		}
+		update[i].next[i] = x.next[i]
+	}
+	for s.level > 1 && s.head.next[s.level-1] == nil {
+		s.level--
+	}
+	s.length--
+}
+
+// seek returns the first node with key >= from, or the first node if from is not valid
+func (s *skipList) seek(from reflect.Value) *skipNode {
+	if !from.IsValid() {
+		return s.head.next[0]
+	}
+	x := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && s.cmp(x.next[i].key, from) < 0 {
+			x = x.next[i]
+		}
+	}
+	return x.next[0]
+}
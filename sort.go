@@ -0,0 +1,115 @@
+package rdblite
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// SortKey orders query results by a field of T
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// Asc sort key for field
+func Asc(fieldname string) SortKey {
+	return SortKey{Field: fieldname}
+}
+
+// Desc sort key for field
+func Desc(fieldname string) SortKey {
+	return SortKey{Field: fieldname, Desc: true}
+}
+
+// QuerySorted with a predicate and results ordered by the sort keys, ties are ordered by ID
+func (t *Table[T]) QuerySorted(predicate func(row T) bool, keys ...SortKey) ([]T, error) {
+	return t.QueryPagedSorted(0, -1, predicate, keys...)
+}
+
+// QueryPagedSorted with a predicate ordered by the sort keys then paged by start and count,
+// a count < 0 returns all rows after start
+func (t *Table[T]) QueryPagedSorted(start int, count int, predicate func(row T) bool, keys ...SortKey) ([]T, error) {
+	less, e := sortLess[T](keys)
+	if e != nil {
+		return nil, e
+	}
+	return t.QueryPagedSortedFunc(start, count, predicate, less), nil
+}
+
+// QuerySortedFunc with a predicate and results ordered by the less function, ties are ordered by ID
+func (t *Table[T]) QuerySortedFunc(predicate func(row T) bool, less func(a, b T) bool) []T {
+	return t.QueryPagedSortedFunc(0, -1, predicate, less)
+}
+
+// QueryPagedSortedFunc with a predicate ordered by the less function then paged by start and count,
+// a count < 0 returns all rows after start
+func (t *Table[T]) QueryPagedSortedFunc(start int, count int, predicate func(row T) bool, less func(a, b T) bool) []T {
+	stime := time.Now()
+	var data []T
+	t.m.RLock()
+	for _, r := range t.rows {
+		if predicate(*r) {
+			data = append(data, *r)
+		}
+	}
+	t.m.RUnlock()
+
+	// storage order changes on delete so break ties by ID for stable pages
+	sort.Slice(data, func(i, j int) bool {
+		if less(data[i], data[j]) {
+			return true
+		}
+		if less(data[j], data[i]) {
+			return false
+		}
+		return data[i].getID() < data[j].getID()
+	})
+
+	if start >= len(data) {
+		data = nil
+	} else if start > 0 {
+		data = data[start:]
+	}
+	if count >= 0 && count < len(data) {
+		data = data[:count]
+	}
+	log.Println("query sorted time =", time.Since(stime))
+	return data
+}
+
+// sortLess builds a less function from the sort keys
+func sortLess[T any](keys []SortKey) (func(a, b T) bool, error) {
+	type sortField struct {
+		field
+		desc bool
+		cmp  func(a, b reflect.Value) int
+	}
+	var fields []sortField
+	for _, k := range keys {
+		f, e := lookupField[T](k.Field)
+		if e != nil {
+			return nil, e
+		}
+		cmp, ok := comparer(f.typ)
+		if !ok {
+			return nil, fmt.Errorf("field %s of type %s can not be sorted", f.name, f.typ)
+		}
+		fields = append(fields, sortField{field: f, desc: k.Desc, cmp: cmp})
+	}
+	return func(a, b T) bool {
+		for _, f := range fields {
+			c := f.cmp(f.value(&a), f.value(&b))
+			if c == 0 {
+				continue
+			}
+			if f.desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	}, nil
+}
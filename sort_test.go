@@ -0,0 +1,48 @@
+package rdblite
+
+import (
+	"testing"
+)
+
+func Test_sorted_query(t *testing.T) {
+	createTest()
+	tt := Table[Testdata]{
+		GobFilename: "test/test.gob",
+	}
+	tt.LoadGob()
+
+	all := func(row Testdata) bool { return true }
+
+	rows, e := tt.QuerySorted(all, Desc("Age"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	for i := 1; i < len(rows); i++ {
+		if rows[i].Age > rows[i-1].Age {
+			t.Fatal("not sorted descending")
+		}
+	}
+
+	// pages are applied after ordering
+	page, _ := tt.QueryPagedSorted(10, 5, all, Desc("Age"))
+	if len(page) != 5 || page[0].ID != rows[10].ID || page[4].ID != rows[14].ID {
+		t.Error("page does not match sorted rows")
+	}
+	page, _ = tt.QueryPagedSorted(95, 10, all, Asc("Age"))
+	if len(page) != 4 {
+		t.Error("expected last 4 rows got", len(page))
+	}
+
+	// ties are broken by ID
+	rows = tt.QuerySortedFunc(all, func(a, b Testdata) bool { return a.Age%2 < b.Age%2 })
+	for i := 1; i < len(rows); i++ {
+		if rows[i].Age%2 == rows[i-1].Age%2 && rows[i].ID < rows[i-1].ID {
+			t.Fatal("ties not ordered by ID")
+		}
+	}
+
+	if _, e = tt.QuerySorted(all, Asc("Missing")); e == nil {
+		t.Error("expected error for missing field")
+	}
+	tt.Close()
+}
@@ -181,6 +181,26 @@ func (sf *StorageFile) Save(dtype string, data []byte) int64 {
 	return i
 }
 
+// SaveSync saves data and fsyncs the files so it survives an OS crash or power loss,
+// returns the write error if the data is not on disk
+func (sf *StorageFile) SaveSync(dtype string, data []byte) (int64, error) {
+	sf.Lock()
+	defer sf.Unlock()
+
+	i := sf.internalSave(dtype, data, false)
+	sf.dirty = false
+	if e := sf.writer.Flush(); e != nil {
+		return i, e
+	}
+	if e := sf.idxwriter.Flush(); e != nil {
+		return i, e
+	}
+	if e := sf.file.Sync(); e != nil {
+		return i, e
+	}
+	return i, sf.idx.Sync()
+}
+
 func (sf *StorageFile) internalSave(dtype string, data []byte, skip bool) int64 {
 
 	sf.dirty = true
@@ -410,7 +430,7 @@ func (sf *StorageFile) rebuildIndex() error {
 		}
 		dtlen := int16(binary.LittleEndian.Uint16(buf[22:]))
 		datalen := int32(binary.LittleEndian.Uint32(buf[24:]))
-		b := make([]byte, dtlen+int16(datalen))
+		b := make([]byte, int(dtlen)+int(datalen))
 		n, _ = io.ReadFull(datrdr, b)
 		if n == 0 {
 			fmt.Println("zero bytes @count=", count)
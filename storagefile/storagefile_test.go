@@ -332,3 +332,26 @@ func now() time.Time {
 	syscall.Gettimeofday(&tv)
 	return time.Unix(0, syscall.TimevalToNsec(tv))
 }
+
+func Test_save_sync(t *testing.T) {
+	defer func() {
+		os.Remove("sync.dat")
+		os.Remove("sync.dat.idx")
+	}()
+	os.Remove("sync.dat")
+	sf, e := storagefile.Open("sync.dat")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if _, e = sf.SaveSync("a", []byte("123")); e != nil {
+		t.Error(e)
+	}
+	// on disk without a flush or close
+	if fi, _ := os.Stat("sync.dat"); fi.Size() == 0 {
+		t.Error("data not written")
+	}
+	if _, d, e := sf.GetString(1); e != nil || d != "123" {
+		t.Error("read failed", d, e)
+	}
+	sf.Close()
+}
@@ -0,0 +1,113 @@
+package rdblite
+
+import (
+	"sync/atomic"
+)
+
+const (
+	SUBSCRIBE_BUFFER = 100
+)
+
+type EventType int
+
+const (
+	EventInsert EventType = iota
+	EventUpdate
+	EventDelete
+)
+
+func (e EventType) String() string {
+	switch e {
+	case EventInsert:
+		return "insert"
+	case EventUpdate:
+		return "update"
+	case EventDelete:
+		return "delete"
+	}
+	return "unknown"
+}
+
+// Event is a change to a row, Old is nil for inserts and New is nil for deletes
+type Event[T tableInterface] struct {
+	Type EventType
+	ID   int
+	Old  *T
+	New  *T
+}
+
+// Subscription receives row change events on C until Unsubscribe()
+type Subscription[T tableInterface] struct {
+	C       <-chan Event[T]
+	c       chan Event[T]
+	t       *Table[T]
+	filter  func(Event[T]) bool
+	dropped int64
+}
+
+// Subscribe to row changes matching filter, nil for all changes. Events are buffered up to buffer
+// (default SUBSCRIBE_BUFFER), when the buffer is full events are dropped so a slow reader never blocks writes.
+// * events are sent while the table is locked so don't call Unsubscribe() or write to the table in filter
+func (t *Table[T]) Subscribe(filter func(e Event[T]) bool, buffer int) *Subscription[T] {
+	if buffer <= 0 {
+		buffer = SUBSCRIBE_BUFFER
+	}
+	c := make(chan Event[T], buffer)
+	s := &Subscription[T]{
+		C:      c,
+		c:      c,
+		t:      t,
+		filter: filter,
+	}
+	t.m.Lock()
+	t.subs = append(t.subs, s)
+	t.m.Unlock()
+	return s
+}
+
+// Unsubscribe stops events and closes C
+func (s *Subscription[T]) Unsubscribe() {
+	t := s.t
+	t.m.Lock()
+	defer t.m.Unlock()
+	for i, sub := range t.subs {
+		if sub == s {
+			t.subs = append(t.subs[:i], t.subs[i+1:]...)
+			close(s.c)
+			return
+		}
+	}
+}
+
+// Dropped is the number of events not sent because the buffer was full
+func (s *Subscription[T]) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
+
+// notify subscribers of a change, old and new are copied, callers must hold the lock
+func (t *Table[T]) notify(typ EventType, old, new *T) {
+	if len(t.subs) == 0 {
+		return
+	}
+	e := Event[T]{Type: typ}
+	if old != nil {
+		o := *old
+		e.Old = &o
+		e.ID = o.getID()
+	}
+	if new != nil {
+		n := *new
+		e.New = &n
+		e.ID = n.getID()
+	}
+	for _, s := range t.subs {
+		if s.filter != nil && !s.filter(e) {
+			continue
+		}
+		select {
+		case s.c <- e:
+		default:
+			atomic.AddInt64(&s.dropped, 1)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package rdblite
+
+import (
+	"testing"
+)
+
+func Test_subscribe(t *testing.T) {
+	createTest()
+	tt := Table[Testdata]{
+		GobFilename: "test/test.gob",
+	}
+	tt.LoadGob()
+	defer tt.stopTimer()
+
+	all := tt.Subscribe(nil, 0)
+	deletes := tt.Subscribe(func(e Event[Testdata]) bool {
+		return e.Type == EventDelete
+	}, 1)
+
+	id := tt.AddUpdate(Testdata{Name: "new"})
+	tt.UpdateFunc(id, func(r *Testdata) { r.Name = "changed" })
+	tt.Delete(id)
+	tt.Delete(1)
+
+	e := <-all.C
+	if e.Type != EventInsert || e.ID != id || e.Old != nil || e.New.Name != "new" {
+		t.Error("bad insert event", e)
+	}
+	e = <-all.C
+	if e.Type != EventUpdate || e.Old.Name != "new" || e.New.Name != "changed" {
+		t.Error("bad update event", e)
+	}
+	e = <-all.C
+	if e.Type != EventDelete || e.Old.Name != "changed" || e.New != nil {
+		t.Error("bad delete event", e)
+	}
+
+	// buffer of 1 so the second delete is dropped
+	e = <-deletes.C
+	if e.Type != EventDelete || e.ID != id {
+		t.Error("bad filtered event", e)
+	}
+	if deletes.Dropped() != 1 || len(deletes.C) != 0 {
+		t.Error("expected 1 dropped event got", deletes.Dropped())
+	}
+
+	// transactions send events on commit
+	tx := tt.Begin()
+	tx.AddUpdate(Testdata{Name: "tx"})
+	if len(all.C) != 1 {
+		// the delete of 1
+		t.Error("expected 1 event before commit got", len(all.C))
+	}
+	tx.Commit()
+	<-all.C
+	if e = <-all.C; e.Type != EventInsert || e.New.Name != "tx" {
+		t.Error("bad tx event", e)
+	}
+
+	all.Unsubscribe()
+	deletes.Unsubscribe()
+	tt.AddUpdate(Testdata{Name: "after"})
+	if _, ok := <-all.C; ok {
+		t.Error("channel should be closed")
+	}
+}
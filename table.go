@@ -3,233 +3,453 @@ package rdblite
 import (
 	"encoding/gob"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 	"unsafe"
+
+	"github.com/mgholam/rdblite/storagefile"
 )
 
 const (
 	SAVE_TIMER = 15
 )
 
+var (
+	ErrNoFilename  = errors.New("table gob filename not set")
+	ErrNotFound    = errors.New("id not found")
+	ErrDuplicateID = errors.New("id already exists")
+	ErrInvalidID   = errors.New("id can not be negative")
+)
+
 type tableInterface interface {
 	getID() int
+	getVersion() int
 	contains(string) bool
+	text() string
 	// setID(int)
 }
 
 // BaseTable to inhierit ID from
 type BaseTable struct {
-	ID     int
-	rowstr string
+	ID      int
+	Version int // incremented on every update, see UpdateIfVersion()
+	rowstr  string
 }
 
 func (t BaseTable) contains(str string) bool {
 	return strings.Contains(t.rowstr, str)
 }
 
+func (t BaseTable) text() string {
+	return t.rowstr
+}
+
 func (t BaseTable) getID() int {
 	return t.ID
 }
 
+func (t BaseTable) getVersion() int {
+	return t.Version
+}
+
+// Table of rows, safe for concurrent use. Reads run in parallel and writes are serialized
 type Table[T tableInterface] struct {
-	m           sync.Mutex
-	GobFilename string
-	rows        []*T
-	lastID      int
-	isDirty     bool
-	initialized bool
-	stimer      *time.Ticker
+	m             sync.RWMutex
+	once          sync.Once
+	name          string // in a Database
+	GobFilename   string
+	JsonFilename  string // loaded by a Database when there is no gob file, default name.json in its directory
+	KeepBackup    bool   // keep the previous gob file as GobFilename.bak on save
+	KeepIDs       bool   // AddUpdate() inserts new rows with their ID if > 0 instead of the next ID
+	WALFilename   string // optional write ahead log of changes between saves, replayed on load
+	SavePolicy    SavePolicy
+	wal           *storagefile.StorageFile
+	sharedWAL     bool  // wal is the Database journal
+	walErr        error // the log could not be reopened, writes fail until it is
+	FullTextIndex bool  // index words for Search() instead of substring matching, set before loading
+	fulltext      *invertedIndex
+	rows          []*T
+	ids           map[int]int // ID -> index in rows
+	indexes       map[string]*hashIndex
+	sorted        map[string]*sortedIndex
+	weights       map[string]float64 // field weights for SearchRanked()
+	formatters    map[string]func(v any) string
+	fields        []field
+	lastID        int
+	isDirty       bool
+	changes       int // since the last save
+	stimer        *time.Ticker
+	done          chan struct{} // stops the save timer goroutine
+	subs          []*Subscription[T]
+	hooks         tableHooks[T]
+	refs          []reference // fields referencing other tables
+	referrers     []referrer  // fields of other tables referencing this table
+	seq           int64       // lock order, see lockTables()
 }
 
 func (t *Table[T]) init() {
-	if t.initialized {
-		return
-	}
-	log.Println("save timer started...")
-	// start save timer
-	t.stimer = time.NewTicker(SAVE_TIMER * time.Second)
-	go func() {
-		for {
-			<-t.stimer.C
-			if t.isDirty {
-				log.Println("--- timer save ---")
-				t.SaveGob()
+	t.once.Do(func() {
+		t.m.Lock()
+		t.setup()
+		if t.wal == nil {
+			if e := t.openWAL(); e != nil {
+				log.Println("write ahead log error", e)
 			}
 		}
-	}()
-
-	t.initialized = true
+		t.m.Unlock()
+		t.startTimer()
+	})
 }
 
-func (t *Table[T]) Close() {
+// Close stops the save timer and saves the table
+func (t *Table[T]) Close() error {
 	log.Println("--- closing table ---")
-	if t.stimer != nil {
-		t.stimer.Stop()
+	t.stopTimer()
+	e := t.SaveGob()
+	if e != nil {
+		return e
 	}
-	t.SaveGob()
+	t.m.Lock()
+	t.closeWAL()
+	t.m.Unlock()
+	return nil
 }
 
 func (t *Table[T]) TotalRows() int {
+	t.m.RLock()
+	defer t.m.RUnlock()
 	return len(t.rows)
 }
 
 // Load binary serialized data from disk, not thread safe only call on startup
-func (t *Table[T]) LoadGob() {
+func (t *Table[T]) LoadGob() error {
 	if t.GobFilename == "" {
-		log.Fatalln("table gob filename not set")
-		return
+		return ErrNoFilename
 	}
 	start := time.Now()
 	gg, e := os.Open(t.GobFilename)
 	if e != nil {
-		log.Fatalln(e)
-		return
+		return e
 	}
 	defer gg.Close()
+	var rows []*T
 	decoder := gob.NewDecoder(gg)
-	e = decoder.Decode(&t.rows)
+	e = decoder.Decode(&rows)
 	if e != nil {
-		log.Fatalln(e)
-		return
+		return fmt.Errorf("%s : %w", t.GobFilename, e)
 	}
+	t.rows = rows
 	log.Printf("%s : item count = %d\n", t.GobFilename, len(t.rows))
 	log.Println("read gob time =", time.Since(start))
 
 	// generate rowstr for fast Search()
 	start = time.Now()
 
-	for _, r := range t.rows {
-		go genstr(r)
-		item := *r
-		if item.getID() > t.lastID {
-			t.lastID = item.getID()
-		}
-	}
+	t.setup()
+	t.genstrAll()
+	t.reindex()
 	log.Println("init search time =", time.Since(start))
+	if e := t.openWAL(); e != nil {
+		return e
+	}
 	t.init()
+	// rows are loaded even with duplicates so they can be fixed
+	return t.duplicates()
 }
 
-// Save data for table as gob file
-func (t *Table[T]) SaveGob() {
+// Save data for table as gob file, written to a temp file and renamed so a crash
+// will leave either the old or the new file
+func (t *Table[T]) SaveGob() error {
+	start := time.Now()
+	t.m.Lock()
+	rows := len(t.rows)
+	e := t.save()
+	t.m.Unlock()
+	t.onSave(rows, start, e)
+	return e
+}
+
+// save callers must hold the lock
+func (t *Table[T]) save() error {
 	if t.GobFilename == "" {
-		log.Fatalln("table gob filename not set")
-		return
+		return ErrNoFilename
 	}
-	t.m.Lock()
-	defer t.m.Unlock()
 	start := time.Now()
-	gg, _ := os.Create(t.GobFilename)
-	defer gg.Close()
-	decoder := gob.NewEncoder(gg)
-	e := decoder.Encode(t.rows)
-	if e != nil {
-		log.Fatalln("save error", e)
-		return
+	if e := t.writeGob(t.GobFilename, t.KeepBackup); e != nil {
+		return e
 	}
 	log.Printf("%s : item count = %d\n", t.GobFilename, len(t.rows))
 	log.Println("write gob", time.Since(start))
 	t.isDirty = false
+	t.changes = 0
+	// changes are in the gob file now
+	return t.truncateWAL()
 }
 
-// Load json file for table
-func (t *Table[T]) LoadJson(fn string) {
+// writeGob of the rows to filename, callers must hold the lock
+func (t *Table[T]) writeGob(filename string, backup bool) error {
+	e := writeFileAtomic(filename, backup, func(w io.Writer) error {
+		return gob.NewEncoder(w).Encode(t.rows)
+	})
+	if e != nil {
+		return fmt.Errorf("%s : %w", filename, e)
+	}
+	return nil
+}
+
+// Load json file for table, not thread safe only call on startup
+func (t *Table[T]) LoadJson(fn string) error {
 	start := time.Now()
-	b, _ := os.ReadFile(fn)
-	json.Unmarshal(b, &t.rows)
+	b, e := os.ReadFile(fn)
+	if e != nil {
+		return e
+	}
+	var rows []*T
+	e = json.Unmarshal(b, &rows)
+	if e != nil {
+		return fmt.Errorf("%s : %w", fn, e)
+	}
+	t.rows = rows
 	log.Println("loading", fn, ",time =", time.Since(start))
 	start = time.Now()
-	for _, r := range t.rows {
-		go genstr(r)
-		item := *r
-		if item.getID() > t.lastID {
-			t.lastID = item.getID()
-		}
-	}
+	t.setup()
+	t.genstrAll()
+	t.reindex()
 	log.Println("init search time =", time.Since(start))
+	if e := t.openWAL(); e != nil {
+		return e
+	}
 	t.init()
+	// rows are loaded even with duplicates so they can be fixed
+	return t.duplicates()
 }
 
-// AddUpdate a row with locking
+// AddUpdate a row with locking, rows with an ID not in the table are inserted with the next ID
+// unless KeepIDs is set. Returns 0 on error, use Insert(), Update() or Upsert() to get the
+// error when hooks or Validate() can reject the row
 func (t *Table[T]) AddUpdate(r T) int {
 	t.init()
-	genstr(&r)
-	found, idx := t.findIndex(r.getID())
-	if found {
-		// FIX: update row here -> copy data from r to item ??
-		t.m.Lock()
-		t.rows[idx] = &r
-		t.m.Unlock()
-		t.isDirty = true
-		return r.getID()
+	unlock := t.writeLock(false)
+	id := t.addUpdate(&r)
+	unlock()
+	t.autoSave()
+	return id
+}
+
+// addUpdate callers must hold the lock
+func (t *Table[T]) addUpdate(r *T) int {
+	id := (*r).getID()
+	if found, _ := t.findIndex(id); !found && !(t.KeepIDs && id > 0) {
+		// new row so set ID
+		setID(r, t.lastID+1)
 	}
-	// set ID
-	t.m.Lock()
-	t.lastID++
-	e := reflect.ValueOf(&r).Elem()
-	rr := e.FieldByName("ID")
-	rr = reflect.NewAt(rr.Type(), unsafe.Pointer(rr.UnsafeAddr())).Elem()
-	rr.SetInt(int64(t.lastID))
-	t.rows = append(t.rows, &r)
-	t.isDirty = true
-	t.m.Unlock()
-	return r.getID()
+	if e := t.write(r); e != nil {
+		log.Println("add update error", e)
+		return 0
+	}
+	return (*r).getID()
+}
+
+// Insert a new row, an ID > 0 is kept and must not be in the table, 0 gets the next ID
+func (t *Table[T]) Insert(r T) (int, error) {
+	return t.locked("insert", &r, t.insert)
+}
+
+// Update an existing row, the ID must be in the table
+func (t *Table[T]) Update(r T) error {
+	_, e := t.locked("update", &r, t.updateRow)
+	return e
+}
+
+// Upsert updates the row if the ID is in the table otherwise inserts it like Insert()
+func (t *Table[T]) Upsert(r T) (int, error) {
+	return t.locked("upsert", &r, func(r *T) error {
+		if found, _ := t.findIndex((*r).getID()); found {
+			return t.write(r)
+		}
+		return t.insert(r)
+	})
+}
+
+// locked runs fn with the lock and returns the row ID
+func (t *Table[T]) locked(op string, r *T, fn func(r *T) error) (int, error) {
+	t.init()
+	start := time.Now()
+	unlock := t.writeLock(false)
+	e := fn(r)
+	unlock()
+	if e != nil {
+		log.Println(op, e, time.Since(start))
+		return 0, e
+	}
+	log.Println(op, "time =", time.Since(start))
+	t.autoSave()
+	return (*r).getID(), nil
+}
+
+// insert callers must hold the lock
+func (t *Table[T]) insert(r *T) error {
+	id := (*r).getID()
+	switch {
+	case id < 0:
+		return ErrInvalidID
+	case id == 0:
+		setID(r, t.lastID+1)
+	default:
+		if found, _ := t.findIndex(id); found {
+			return ErrDuplicateID
+		}
+	}
+	// put keeps lastID at the highest ID
+	return t.write(r)
+}
+
+// updateRow callers must hold the lock
+func (t *Table[T]) updateRow(r *T) error {
+	if found, _ := t.findIndex((*r).getID()); !found {
+		return ErrNotFound
+	}
+	return t.write(r)
+}
+
+// write the row with the next version to the log and rows, callers must hold the lock
+func (t *Table[T]) write(r *T) error {
+	if e := t.beforeWrite(r); e != nil {
+		return e
+	}
+	if e := t.checkUnique(map[int]*T{(*r).getID(): r}, []int{(*r).getID()}); e != nil {
+		return e
+	}
+	if e := t.checkRefs(r, nil); e != nil {
+		return e
+	}
+	t.nextVersion(r)
+	t.genstr(r)
+	if e := t.logPut(r); e != nil {
+		return e
+	}
+	t.put(r)
+	t.afterWrite(r)
+	return nil
 }
 
 // Delete a row with locking
-func (t *Table[T]) Delete(id int) {
+func (t *Table[T]) Delete(id int) error {
 	t.init()
 	start := time.Now()
+	unlock := t.writeLock(true)
+	e := t.delete(id)
+	unlock()
+	if e != nil {
+		log.Println("delete by id", e, time.Since(start))
+		return e
+	}
+	log.Println("delete by id time =", time.Since(start))
+	t.autoSave()
+	t.autoSaveChildren()
+	return nil
+}
+
+// delete callers must hold the lock
+func (t *Table[T]) delete(id int) error {
 	found, idx := t.findIndex(id)
 	if !found {
-		log.Println("delete by id not found ", time.Since(start))
-		return
+		return ErrNotFound
 	}
-	t.m.Lock()
-	if idx < len(t.rows)-1 {
+	if len(t.referrers) > 0 {
+		// the cascaded changes are checked first and logged with the delete
+		tx := t.newTx()
+		tx.set(id, nil)
+		return tx.commit()
+	}
+	r := t.rows[idx]
+	if e := t.beforeDelete(r); e != nil {
+		return e
+	}
+	if e := t.logDelete(id); e != nil {
+		return e
+	}
+	t.remove(idx)
+	t.afterDelete(r)
+	return nil
+}
+
+// put inserts or replaces the row by ID, callers must hold the lock
+func (t *Table[T]) put(r *T) {
+	id := (*r).getID()
+	if found, idx := t.findIndex(id); found {
+		old := t.rows[idx]
+		t.unindexRow(old)
+		t.rows[idx] = r
+		t.notify(EventUpdate, old, r)
+	} else {
+		t.ids[id] = len(t.rows)
+		t.rows = append(t.rows, r)
+		if id > t.lastID {
+			t.lastID = id
+		}
+		t.notify(EventInsert, nil, r)
+	}
+	t.indexRow(r)
+	t.isDirty = true
+	t.changes++
+}
+
+// remove the row at idx, callers must hold the lock
+func (t *Table[T]) remove(idx int) {
+	id := (*t.rows[idx]).getID()
+	t.unindexRow(t.rows[idx])
+	t.notify(EventDelete, t.rows[idx], nil)
+	last := len(t.rows) - 1
+	if idx < last {
 		// Copy last element to index idx
-		t.rows[idx] = t.rows[len(t.rows)-1]
+		t.rows[idx] = t.rows[last]
+		t.ids[(*t.rows[idx]).getID()] = idx
 	}
 	// Erase last element (write zero value)
-	// t.rows[len(t.rows)-1] = *new(T)
-	t.rows = t.rows[:len(t.rows)-1]
+	t.rows[last] = nil
+	t.rows = t.rows[:last]
+	delete(t.ids, id)
 	t.isDirty = true
-	t.m.Unlock()
-	log.Println("delete by id time =", time.Since(start))
+	t.changes++
 }
 
 // FindByID item by id will return nil if not found
 func (t *Table[T]) FindByID(id int) (bool, T) {
 	start := time.Now()
 
-	for _, r := range t.rows {
-		// 25x faster than reflect.ValueOf(r).Elem()
-		t.m.Lock()
-		item := *r
-		t.m.Unlock()
-		if item.getID() == id {
-			log.Println("find by id time =", time.Since(start))
-			return true, item
-		}
+	t.m.RLock()
+	found, idx := t.findIndex(id)
+	if !found {
+		t.m.RUnlock()
+		return false, *new(T)
 	}
+	item := *t.rows[idx]
+	t.m.RUnlock()
 
-	return false, *new(T)
+	log.Println("find by id time =", time.Since(start))
+	return true, item
 }
 
 // Query with a predicate for more control over querying
 func (t *Table[T]) Query(predicate func(row T) bool) []T {
 	start := time.Now()
 	var data []T
+	t.m.RLock()
 	for _, r := range t.rows {
 		if predicate(*r) {
 			data = append(data, *r)
 		}
 	}
+	t.m.RUnlock()
 	log.Println("query time =", time.Since(start))
 	return data
 }
@@ -238,6 +458,8 @@ func (t *Table[T]) Query(predicate func(row T) bool) []T {
 func (t *Table[T]) QueryPaged(start int, count int, predicate func(row T) bool) []T {
 	stime := time.Now()
 	var data []T
+	t.m.RLock()
+	defer t.m.RUnlock()
 	for _, r := range t.rows {
 		if count == 0 {
 			break
@@ -256,54 +478,134 @@ func (t *Table[T]) QueryPaged(start int, count int, predicate func(row T) bool)
 	return data
 }
 
-// Search on any field contains str
+// Search on any field contains str, see search.go for the query syntax.
+// With FullTextIndex terms match whole words
 func (t *Table[T]) Search(str string) []T {
+	return t.search(str, true)
+}
+
+// SearchSubstring like Search but terms match any part of a word even with FullTextIndex
+func (t *Table[T]) SearchSubstring(str string) []T {
+	return t.search(str, false)
+}
+
+func (t *Table[T]) search(str string, indexed bool) []T {
 	start := time.Now()
-	str = strings.ToLower(strings.Trim(str, " \t"))
-	v := strings.Split(str, " ")
 	var data []T
-	// FIX: implement OR
-	for _, r := range t.rows {
-		item := *r
-		found := 0
-		vc := 0
-		for _, s := range v {
-			if s == "" {
-				continue
+	t.m.RLock()
+	var ix *invertedIndex
+	if indexed {
+		ix = t.fulltext
+	}
+	for _, r := range t.matchRows(parseSearch[T](str, ix, t.fields)) {
+		data = append(data, *r)
+	}
+	t.m.RUnlock()
+	log.Println("search time =", time.Since(start))
+	return data
+}
+
+// matchRows returns the rows matching node in storage order, callers must hold the lock
+func (t *Table[T]) matchRows(node searchNode[T]) []*T {
+	var rows []*T
+	if node != nil {
+		if ids, ok := candidates(node); ok {
+			pos := make([]int, 0, len(ids))
+			for id := range ids {
+				pos = append(pos, t.ids[id])
 			}
-			// 10x faster than reflect
-			// currently AND search
-			if item.contains(s) {
-				found++
+			// keep storage order like a full scan
+			sort.Ints(pos)
+			for _, idx := range pos {
+				if node.match(t.rows[idx]) {
+					rows = append(rows, t.rows[idx])
+				}
 			}
-			vc++
+			return rows
 		}
-		if found == vc {
-			data = append(data, *r)
+	}
+	for _, r := range t.rows {
+		// 10x faster than reflect
+		if node == nil || node.match(r) {
+			rows = append(rows, r)
 		}
 	}
-	log.Println("search time =", time.Since(start))
-	return data
+	return rows
 }
 
+// findIndex uses the ID map, callers must hold the lock
 func (t *Table[T]) findIndex(id int) (bool, int) {
-	if id <= 0 {
+	if id <= 0 || t.ids == nil {
+		return false, -1
+	}
+	idx, ok := t.ids[id]
+	if !ok {
 		return false, -1
 	}
+	return true, idx
+}
+
+// reindex rebuilds the ID map, secondary indexes and lastID from rows
+func (t *Table[T]) reindex() {
+	t.setup()
+	t.ids = make(map[int]int, len(t.rows))
+	for _, ix := range t.indexes {
+		ix.values = make(map[any]map[int]struct{})
+	}
+	for _, ix := range t.sorted {
+		ix.list = newSkipList(ix.list.cmp)
+	}
+	if t.fulltext != nil {
+		t.fulltext = newInvertedIndex()
+	}
 	for idx, r := range t.rows {
-		item := *r
-		if item.getID() == id {
-			return true, idx
+		id := (*r).getID()
+		t.ids[id] = idx
+		t.indexRow(r)
+		if id > t.lastID {
+			t.lastID = id
 		}
 	}
+}
+
+func setID[T any](item *T, id int) {
+	e := reflect.ValueOf(item).Elem()
+	rr := e.FieldByName("ID")
+	rr = reflect.NewAt(rr.Type(), unsafe.Pointer(rr.UnsafeAddr())).Elem()
+	rr.SetInt(int64(id))
+}
 
-	return false, -1
+// genstrAll generates rowstr for all rows in parallel
+func (t *Table[T]) genstrAll() {
+	var wg sync.WaitGroup
+	for _, r := range t.rows {
+		wg.Add(1)
+		go func(r *T) {
+			t.genstr(r)
+			wg.Done()
+		}(r)
+	}
+	wg.Wait()
 }
 
-func genstr[T any](item *T) {
-	str := fmt.Sprintf("%v", item)
+// genstr sets rowstr to the text of the searchable fields
+func (t *Table[T]) genstr(item *T) {
+	var sb strings.Builder
+	for _, f := range t.fields {
+		if !f.search {
+			continue
+		}
+		str := f.text(item)
+		if str == "" {
+			continue
+		}
+		if sb.Len() > 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(str)
+	}
 	e := reflect.ValueOf(item).Elem()
 	rr := e.FieldByName("rowstr")
 	rr = reflect.NewAt(rr.Type(), unsafe.Pointer(rr.UnsafeAddr())).Elem()
-	rr.SetString(strings.ToLower(str))
+	rr.SetString(sb.String())
 }
@@ -2,12 +2,14 @@ package rdblite
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 )
 
 type Testdata struct {
@@ -136,6 +138,189 @@ func Test_multithread(t *testing.T) {
 	// }
 }
 
+func Test_findbyid_after_delete(t *testing.T) {
+	createTest()
+	tt := Table[Testdata]{
+		GobFilename: "test/test.gob",
+	}
+	tt.LoadGob()
+
+	// delete swaps the last row into the hole
+	tt.Delete(1)
+	tt.Delete(50)
+	if ok, _ := tt.FindByID(1); ok {
+		t.Error("deleted id 1 found")
+	}
+	for _, id := range []int{2, 49, 51, 99} {
+		ok, r := tt.FindByID(id)
+		if !ok || r.ID != id {
+			t.Error("id not found", id)
+		}
+	}
+
+	id := tt.AddUpdate(Testdata{Name: "new", Age: 1})
+	if id != 100 {
+		t.Error("expected new id 100 got", id)
+	}
+	ok, r := tt.FindByID(id)
+	if !ok || r.Name != "new" {
+		t.Error("inserted row not found")
+	}
+	tt.Close()
+}
+
+func Test_load_save_errors(t *testing.T) {
+	os.Mkdir("test", 0755)
+	tt := Table[Testdata]{}
+	if e := tt.LoadGob(); !errors.Is(e, ErrNoFilename) {
+		t.Error("expected ErrNoFilename got", e)
+	}
+	if e := tt.SaveGob(); !errors.Is(e, ErrNoFilename) {
+		t.Error("expected ErrNoFilename got", e)
+	}
+
+	tt.GobFilename = "test/missing.gob"
+	if e := tt.LoadGob(); !errors.Is(e, os.ErrNotExist) {
+		t.Error("expected not exist got", e)
+	}
+
+	os.WriteFile("test/corrupt.gob", []byte("not a gob file"), 0644)
+	tt.GobFilename = "test/corrupt.gob"
+	if e := tt.LoadGob(); e == nil {
+		t.Error("expected decode error")
+	}
+
+	if e := tt.LoadJson("test/missing.json"); e == nil {
+		t.Error("expected read error")
+	}
+	os.WriteFile("test/corrupt.json", []byte("[{"), 0644)
+	if e := tt.LoadJson("test/corrupt.json"); e == nil {
+		t.Error("expected unmarshal error")
+	}
+
+	tt.GobFilename = "test/nodir/test.gob"
+	if e := tt.SaveGob(); e == nil {
+		t.Error("expected create error")
+	}
+}
+
+// run with go test -race
+func Test_concurrent_read_write(t *testing.T) {
+	createTest()
+	tt := Table[Testdata]{
+		GobFilename:   "test/test.gob",
+		FullTextIndex: true,
+		SavePolicy:    SavePolicy{Interval: 5 * time.Millisecond},
+	}
+	tt.LoadGob()
+	tt.CreateIndex("Age")
+	tt.CreateSortedIndex("Age")
+
+	var wg sync.WaitGroup
+	for w := 0; w < 2; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				id := tt.AddUpdate(Testdata{Name: randStringRunes(10), Age: i})
+				if i%3 == 0 {
+					tt.Delete(id)
+				}
+			}
+		}()
+	}
+	for rd := 0; rd < 4; rd++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				tt.FindByID(i)
+				tt.FindBy("Age", i)
+				tt.QueryRange("Age", i, i+10)
+				tt.Search("a b")
+				tt.SearchRanked("a")
+				tt.QueryPaged(0, 10, func(row Testdata) bool { return row.Age > i })
+				tt.QuerySorted(func(row Testdata) bool { return true }, Desc("Age"))
+				tt.Count(nil)
+				tt.TotalRows()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 2 writers * (200 - 67 deleted)
+	if n := tt.TotalRows(); n != 99+2*133 {
+		t.Error("expected", 99+2*133, "rows got", n)
+	}
+	if e := tt.Close(); e != nil {
+		t.Error(e)
+	}
+}
+
+func Test_insert_update_upsert(t *testing.T) {
+	createTest()
+	tt := Table[Testdata]{
+		GobFilename: "test/test.gob",
+	}
+	tt.LoadGob()
+	defer tt.stopTimer()
+
+	r := Testdata{Name: "new"}
+	if id, e := tt.Insert(r); e != nil || id != 100 {
+		t.Error("insert expected id 100 got", id, e)
+	}
+	// caller IDs are kept and lastID follows
+	r.ID = 500
+	if id, e := tt.Insert(r); e != nil || id != 500 {
+		t.Error("insert expected id 500 got", id, e)
+	}
+	if id := tt.AddUpdate(Testdata{Name: "next"}); id != 501 {
+		t.Error("expected id 501 got", id)
+	}
+	if _, e := tt.Insert(r); e != ErrDuplicateID {
+		t.Error("expected duplicate got", e)
+	}
+	r.ID = -1
+	if _, e := tt.Insert(r); e != ErrInvalidID {
+		t.Error("expected invalid id got", e)
+	}
+
+	r.ID = 600
+	if e := tt.Update(r); e != ErrNotFound {
+		t.Error("expected not found got", e)
+	}
+	r.ID = 500
+	r.Name = "updated"
+	if e := tt.Update(r); e != nil {
+		t.Error(e)
+	}
+	if _, row := tt.FindByID(500); row.Name != "updated" {
+		t.Error("update failed", row)
+	}
+
+	r.ID = 700
+	if id, e := tt.Upsert(r); e != nil || id != 700 {
+		t.Error("upsert insert expected id 700 got", id, e)
+	}
+	r.Name = "upserted"
+	if id, e := tt.Upsert(r); e != nil || id != 700 {
+		t.Error("upsert update expected id 700 got", id, e)
+	}
+	if _, row := tt.FindByID(700); row.Name != "upserted" || row.Version != 2 {
+		t.Error("upsert failed", row)
+	}
+
+	// AddUpdate with KeepIDs
+	tt.KeepIDs = true
+	r.ID = 800
+	if id := tt.AddUpdate(r); id != 800 {
+		t.Error("keep ids expected 800 got", id)
+	}
+	if n := tt.TotalRows(); n != 99+5 {
+		t.Error("expected", 99+5, "rows got", n)
+	}
+}
+
 // type Base struct {
 // 	ID int
 // }
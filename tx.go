@@ -0,0 +1,476 @@
+package rdblite
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"time"
+
+	"github.com/mgholam/rdblite/storagefile"
+)
+
+var (
+	ErrTxDone     = errors.New("transaction already committed or rolled back")
+	ErrTxDatabase = errors.New("transaction is part of a database transaction")
+)
+
+// Tx buffers AddUpdate and Delete on a table and applies them together under one lock on Commit.
+// A Tx is not safe for concurrent use
+type Tx[T tableInterface] struct {
+	t       *Table[T]
+	changes map[int]*T   // nil for delete
+	order   []int        // ids in the order they were first changed
+	inserts map[int]bool // ids reserved for new rows, the commit fails if a caller supplied ID took one
+	done    bool
+	parent  *DBTx // commit and rollback are done by the database transaction
+}
+
+// Begin a transaction on the table
+func (t *Table[T]) Begin() *Tx[T] {
+	t.init()
+	return t.newTx()
+}
+
+func (t *Table[T]) newTx() *Tx[T] {
+	return &Tx[T]{
+		t:       t,
+		changes: make(map[int]*T),
+		inserts: make(map[int]bool),
+	}
+}
+
+func (tx *Tx[T]) set(id int, r *T) {
+	if _, ok := tx.changes[id]; !ok {
+		tx.order = append(tx.order, id)
+	}
+	tx.changes[id] = r
+}
+
+// exists in the transaction or the table
+func (tx *Tx[T]) exists(id int) bool {
+	if r, ok := tx.changes[id]; ok {
+		return r != nil
+	}
+	tx.t.m.RLock()
+	defer tx.t.m.RUnlock()
+	found, _ := tx.t.findIndex(id)
+	return found
+}
+
+// AddUpdate a row in the transaction, new rows get their ID now.
+// Commit fails with ErrDuplicateID if Insert() or Upsert() has used the ID meanwhile
+func (tx *Tx[T]) AddUpdate(r T) (int, error) {
+	if tx.done {
+		return 0, ErrTxDone
+	}
+	if !tx.exists(r.getID()) {
+		// reserve the ID, unused if rolled back
+		tx.t.m.Lock()
+		tx.t.lastID++
+		setID(&r, tx.t.lastID)
+		tx.t.m.Unlock()
+		tx.inserts[r.getID()] = true
+	}
+	tx.set(r.getID(), &r)
+	return r.getID(), nil
+}
+
+// Delete a row in the transaction
+func (tx *Tx[T]) Delete(id int) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	if !tx.exists(id) {
+		return ErrNotFound
+	}
+	tx.set(id, nil)
+	return nil
+}
+
+// FindByID sees the changes in the transaction then the table
+func (tx *Tx[T]) FindByID(id int) (bool, T) {
+	if r, ok := tx.changes[id]; ok {
+		if r == nil {
+			return false, *new(T)
+		}
+		return true, *r
+	}
+	return tx.t.FindByID(id)
+}
+
+// Commit all changes to the table as one change
+func (tx *Tx[T]) Commit() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	if tx.parent != nil {
+		return ErrTxDatabase
+	}
+	tx.done = true
+	start := time.Now()
+	t := tx.t
+	unlock := t.writeLock(tx.deleting())
+	e := tx.commit()
+	unlock()
+	if e != nil {
+		return e
+	}
+	log.Println("commit time =", time.Since(start))
+	t.autoSave()
+	t.autoSaveChildren()
+	return nil
+}
+
+// deleting is true if the transaction deletes rows
+func (tx *Tx[T]) deleting() bool {
+	for _, r := range tx.changes {
+		if r == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// pending returns the changed row for an id in the table, nil for a delete
+func (tx *Tx[T]) pending(id int) (any, bool) {
+	r, ok := tx.changes[id]
+	if !ok || r == nil {
+		return nil, ok
+	}
+	return r, true
+}
+
+// commit callers must hold the lock
+func (tx *Tx[T]) commit() error {
+	s := &txSet{members: []txMember{tx}}
+	return s.commit()
+}
+
+// cascade deletes the row id or sets field f to zero because the row parentID it references
+// is deleted. Rows changed in the transaction that no longer reference it are kept
+func (tx *Tx[T]) cascade(id int, f field, parentID int, onDelete OnDelete) {
+	r, ok := tx.changes[id]
+	if ok && (r == nil || refID(f.value(r)) != parentID) {
+		return
+	}
+	if !ok {
+		found, idx := tx.t.findIndex(id)
+		if !found {
+			return
+		}
+		// copy so the stored row is unchanged until the commit is applied
+		row := *tx.t.rows[idx]
+		r = &row
+	}
+	if onDelete == Cascade {
+		tx.set(id, nil)
+		return
+	}
+	f.value(r).Set(reflect.Zero(f.typ))
+	tx.set(id, r)
+}
+
+// applyChanges as one change for the save policy, callers must hold the lock
+func (tx *Tx[T]) applyChanges() {
+	t := tx.t
+	if len(tx.order) == 0 {
+		return
+	}
+	changes := t.changes
+	tx.apply()
+	t.changes = changes + 1
+}
+
+// records for the write ahead log after running the before hooks and generating rowstr,
+// deletes add their cascaded changes to the set. Callers must hold the lock
+func (tx *Tx[T]) records(s *txSet) ([]walRecord, error) {
+	var recs []walRecord
+	t := tx.t
+	for _, id := range tx.order {
+		r := tx.changes[id]
+		if r != nil && tx.inserts[id] && t.exists(id) {
+			return nil, ErrDuplicateID
+		}
+		if r != nil {
+			if e := t.beforeWrite(r); e != nil {
+				return nil, e
+			}
+		} else if found, idx := t.findIndex(id); found {
+			if e := t.beforeDelete(t.rows[idx]); e != nil {
+				return nil, e
+			}
+			if e := t.checkDelete(id, s.lookup); e != nil {
+				return nil, e
+			}
+		}
+	}
+	// after the hooks have changed the rows
+	if e := t.checkUnique(tx.changes, tx.order); e != nil {
+		return nil, e
+	}
+	for _, id := range tx.order {
+		if r := tx.changes[id]; r != nil {
+			if e := t.checkRefs(r, s.lookup); e != nil {
+				return nil, e
+			}
+		}
+	}
+	// the referencing rows are changed in the same commit
+	for _, id := range tx.order {
+		if tx.changes[id] == nil && t.exists(id) {
+			t.cascade(id, s)
+		}
+	}
+	for _, id := range tx.order {
+		r := tx.changes[id]
+		if r != nil {
+			t.nextVersion(r)
+			t.genstr(r)
+		}
+		if t.wal == nil {
+			continue
+		}
+		if r == nil {
+			recs = append(recs, walRecord{Op: walDelete, ID: id})
+			continue
+		}
+		rec, e := putRecord(r)
+		if e != nil {
+			return nil, e
+		}
+		recs = append(recs, rec)
+	}
+	return recs, nil
+}
+
+// apply the changes to the rows, callers must hold the lock
+func (tx *Tx[T]) apply() {
+	t := tx.t
+	for _, id := range tx.order {
+		r := tx.changes[id]
+		if r == nil {
+			if found, idx := t.findIndex(id); found {
+				old := t.rows[idx]
+				t.remove(idx)
+				t.afterDelete(old)
+			}
+			continue
+		}
+		t.put(r)
+		t.afterWrite(r)
+	}
+}
+
+// Rollback discards all changes, in a database transaction the changes to all tables are discarded
+func (tx *Tx[T]) Rollback() {
+	if tx.parent != nil {
+		tx.parent.Rollback()
+		return
+	}
+	tx.discard()
+}
+
+func (tx *Tx[T]) discard() {
+	tx.done = true
+	tx.changes = nil
+	tx.order = nil
+	tx.inserts = nil
+}
+
+func (tx *Tx[T]) table() dbTable {
+	return tx.t
+}
+
+// txMember is a Tx[T] in a DBTx or a txSet
+type txMember interface {
+	table() dbTable
+	records(s *txSet) ([]walRecord, error)
+	applyChanges()
+	discard()
+	deleting() bool
+	pending(id int) (any, bool)
+	cascade(id int, f field, parentID int, onDelete OnDelete)
+}
+
+// txSet is the transactions committed together, with a transaction for every table
+// the deletes cascade to
+type txSet struct {
+	members []txMember
+	done    map[txMember]bool // records() has run
+}
+
+// member returns the transaction for the table, adding one if needed
+func (s *txSet) member(t refTable) txMember {
+	for _, m := range s.members {
+		if refTable(m.table()) == t {
+			return m
+		}
+	}
+	m := t.cascadeTx()
+	s.members = append(s.members, m)
+	return m
+}
+
+// lookup changed rows of other tables in the set
+func (s *txSet) lookup(t refTable, id int) (any, bool) {
+	for _, m := range s.members {
+		if refTable(m.table()) == t {
+			return m.pending(id)
+		}
+	}
+	return nil, false
+}
+
+// next returns the member without records with the lowest lock order, nil if done.
+// Parents are before their children so all cascades to a table are added before its records
+func (s *txSet) next() txMember {
+	var ts []dbTable
+	for _, m := range s.members {
+		if !s.done[m] {
+			ts = append(ts, m.table())
+		}
+	}
+	if len(ts) == 0 {
+		return nil
+	}
+	first := sortTables(ts)[0]
+	for _, m := range s.members {
+		if !s.done[m] && m.table() == first {
+			return m
+		}
+	}
+	return nil
+}
+
+// commit runs the before hooks and checks of all members, writes the records and applies the changes.
+// Nothing is changed if a member fails. Callers must hold the locks of the tables and the tables below them
+func (s *txSet) commit() error {
+	s.done = make(map[txMember]bool)
+	var order []txMember
+	recs := make(map[txMember][]walRecord)
+	for m := s.next(); m != nil; m = s.next() {
+		r, e := m.records(s)
+		if e != nil {
+			return e
+		}
+		for i := range r {
+			r[i].Table = m.table().tableName()
+		}
+		s.done[m] = true
+		order = append(order, m)
+		recs[m] = r
+	}
+	// one entry for each log so a crash replays all or none of the changes in it,
+	// separate logs are written referencing tables first
+	var logs []*storagefile.StorageFile
+	entries := make(map[*storagefile.StorageFile][]walRecord)
+	for i := len(order) - 1; i >= 0; i-- {
+		wal, e := order[i].table().logFile()
+		if e != nil {
+			return e
+		}
+		if wal == nil || len(recs[order[i]]) == 0 {
+			continue
+		}
+		if _, ok := entries[wal]; !ok {
+			logs = append(logs, wal)
+		}
+		entries[wal] = append(entries[wal], recs[order[i]]...)
+	}
+	for _, wal := range logs {
+		if e := writeWAL(wal, entries[wal]); e != nil {
+			return e
+		}
+	}
+	for i := len(order) - 1; i >= 0; i-- {
+		order[i].applyChanges()
+	}
+	return nil
+}
+
+// DBTx is a transaction over tables in a Database, changes to all tables are applied together on Commit.
+// With Database.WAL the changes are written as one journal entry so after a crash all or none are replayed.
+// A DBTx is not safe for concurrent use
+type DBTx struct {
+	db      *Database
+	members []txMember
+	done    bool
+}
+
+// Begin a transaction over tables in the database, get the transaction for each table with TxFor()
+func (db *Database) Begin() *DBTx {
+	return &DBTx{db: db}
+}
+
+// TxFor returns the transaction for a table in the database transaction,
+// use it for AddUpdate, Delete and FindByID on that table
+func TxFor[T tableInterface](dtx *DBTx, t *Table[T]) (*Tx[T], error) {
+	if dtx.done {
+		return nil, ErrTxDone
+	}
+	dtx.db.m.Lock()
+	registered := t.name != "" && dtx.db.names[t.name] == dbTable(t)
+	dtx.db.m.Unlock()
+	if !registered {
+		return nil, fmt.Errorf("table %q is not in the database", t.name)
+	}
+	for _, m := range dtx.members {
+		if tx, ok := m.(*Tx[T]); ok && tx.t == t {
+			return tx, nil
+		}
+	}
+	tx := t.Begin()
+	tx.parent = dtx
+	dtx.members = append(dtx.members, tx)
+	return tx, nil
+}
+
+// Commit the changes to all tables together
+func (dtx *DBTx) Commit() error {
+	if dtx.done {
+		return ErrTxDone
+	}
+	dtx.done = true
+	start := time.Now()
+	db := dtx.db
+	db.m.Lock()
+	var tables []refTable
+	deleting := false
+	for _, m := range dtx.members {
+		tables = append(tables, m.table())
+		deleting = deleting || m.deleting()
+	}
+	unlock := lockTables(tables, deleting)
+	e := dtx.commit()
+	unlock()
+	db.m.Unlock()
+	for _, m := range dtx.members {
+		m.discard()
+	}
+	if e != nil {
+		return e
+	}
+	log.Println("database commit time =", time.Since(start))
+	for _, m := range dtx.members {
+		m.table().autoSave()
+		m.table().autoSaveChildren()
+	}
+	return nil
+}
+
+// commit callers must hold db.m and the locks of all member tables,
+// with the Database journal the changes to all tables are one entry
+func (dtx *DBTx) commit() error {
+	s := &txSet{members: append([]txMember{}, dtx.members...)}
+	return s.commit()
+}
+
+// Rollback discards the changes to all tables
+func (dtx *DBTx) Rollback() {
+	dtx.done = true
+	for _, m := range dtx.members {
+		m.discard()
+	}
+	dtx.members = nil
+}
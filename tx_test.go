@@ -0,0 +1,89 @@
+package rdblite
+
+import (
+	"os"
+	"testing"
+)
+
+func Test_tx(t *testing.T) {
+	createTest()
+	os.Remove("test/tx.wal")
+	os.Remove("test/tx.wal.idx")
+	tt := Table[Testdata]{
+		GobFilename: "test/test.gob",
+		WALFilename: "test/tx.wal",
+	}
+	tt.LoadGob()
+
+	tx := tt.Begin()
+	id, _ := tx.AddUpdate(Testdata{Name: "invoice", Age: 1})
+	_, r := tx.FindByID(2)
+	r.Name = "updated"
+	tx.AddUpdate(r)
+	tx.Delete(3)
+
+	// read your writes
+	if ok, r := tx.FindByID(id); !ok || r.Name != "invoice" {
+		t.Error("tx insert not visible in tx")
+	}
+	if ok, _ := tx.FindByID(3); ok {
+		t.Error("tx delete not visible in tx")
+	}
+	if e := tx.Delete(3); e != ErrNotFound {
+		t.Error("expected not found for deleted row", e)
+	}
+	// not visible in the table before commit
+	if ok, _ := tt.FindByID(id); ok {
+		t.Error("tx insert visible before commit")
+	}
+	if ok, _ := tt.FindByID(3); !ok {
+		t.Error("tx delete visible before commit")
+	}
+
+	if e := tx.Commit(); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := tx.AddUpdate(r); e != ErrTxDone {
+		t.Error("expected ErrTxDone", e)
+	}
+	if ok, r := tt.FindByID(id); !ok || r.Name != "invoice" {
+		t.Error("insert not committed")
+	}
+	if ok, r := tt.FindByID(2); !ok || r.Name != "updated" {
+		t.Error("update not committed")
+	}
+	if len(tt.Search("updated")) != 1 {
+		t.Error("rowstr not generated on commit")
+	}
+	if ok, _ := tt.FindByID(3); ok {
+		t.Error("delete not committed")
+	}
+	if tt.wal.Count() != 1 || tt.changes != 1 {
+		t.Error("commit should be one change", tt.wal.Count(), tt.changes)
+	}
+
+	tx = tt.Begin()
+	tx.Delete(4)
+	tx.AddUpdate(Testdata{Name: "rolled back"})
+	tx.Rollback()
+	if ok, _ := tt.FindByID(4); !ok || tt.TotalRows() != 99 {
+		t.Error("rollback changed the table")
+	}
+	if e := tx.Commit(); e != ErrTxDone {
+		t.Error("expected ErrTxDone", e)
+	}
+
+	// a caller supplied ID took the reserved one
+	tx = tt.Begin()
+	id, _ = tx.AddUpdate(Testdata{Name: "reserved"})
+	if _, e := tt.Insert(Testdata{BaseTable: BaseTable{ID: id}, Name: "imported"}); e != nil {
+		t.Fatal(e)
+	}
+	if e := tx.Commit(); e != ErrDuplicateID {
+		t.Error("expected ErrDuplicateID", e)
+	}
+	if _, r := tt.FindByID(id); r.Name != "imported" {
+		t.Error("imported row overwritten", r)
+	}
+	tt.Close()
+}
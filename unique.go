@@ -0,0 +1,105 @@
+package rdblite
+
+import (
+	"fmt"
+	"log"
+	"sort"
+)
+
+// ErrUniqueViolation is returned when a write would give two rows the same value
+// for a unique field, or when a load finds duplicates
+type ErrUniqueViolation struct {
+	Field      string
+	Value      any
+	ID         int // row being written
+	ConflictID int // row that has the value
+}
+
+func (e *ErrUniqueViolation) Error() string {
+	return fmt.Sprintf("unique field %s value %v of row %d already used by row %d", e.Field, e.Value, e.ID, e.ConflictID)
+}
+
+// CreateUniqueIndex on a field of T so no two rows have the same value,
+// also done for fields tagged with `rdb:"unique"`. Fails if the rows have duplicates
+func (t *Table[T]) CreateUniqueIndex(fieldname string) error {
+	if e := t.CreateIndex(fieldname); e != nil {
+		return e
+	}
+	f, _ := lookupField[T](fieldname)
+	t.m.Lock()
+	defer t.m.Unlock()
+	ix := t.indexes[f.name]
+	if e := ix.duplicate(); e != nil {
+		return e
+	}
+	ix.unique = true
+	return nil
+}
+
+// duplicate returns the first duplicate value in the index by lowest IDs
+func (ix *hashIndex) duplicate() *ErrUniqueViolation {
+	var err *ErrUniqueViolation
+	for key, ids := range ix.values {
+		if len(ids) < 2 {
+			continue
+		}
+		var list []int
+		for id := range ids {
+			list = append(list, id)
+		}
+		sort.Ints(list)
+		if err == nil || list[0] < err.ConflictID {
+			err = &ErrUniqueViolation{Field: ix.field.name, Value: key, ID: list[1], ConflictID: list[0]}
+		}
+	}
+	return err
+}
+
+// duplicates logs all duplicate values in unique indexes and returns the first,
+// called while loading so not thread safe
+func (t *Table[T]) duplicates() error {
+	var err error
+	for _, ix := range t.indexes {
+		if !ix.unique {
+			continue
+		}
+		for key, ids := range ix.values {
+			if len(ids) > 1 {
+				log.Printf("unique field %s value %v is used by %d rows\n", ix.field.name, key, len(ids))
+			}
+		}
+		if e := ix.duplicate(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// checkUnique checks that the changed rows, nil for a delete, keep the unique fields unique
+// with each other and the rows not changed, callers must hold the lock
+func (t *Table[T]) checkUnique(changes map[int]*T, order []int) error {
+	for _, ix := range t.indexes {
+		if !ix.unique {
+			continue
+		}
+		seen := make(map[any]int)
+		for _, id := range order {
+			r := changes[id]
+			if r == nil {
+				continue
+			}
+			key := ix.field.key(r)
+			if other, ok := seen[key]; ok {
+				return &ErrUniqueViolation{Field: ix.field.name, Value: key, ID: id, ConflictID: other}
+			}
+			seen[key] = id
+			for other := range ix.values[key] {
+				// changed rows are checked with seen
+				if _, changed := changes[other]; !changed && other != id {
+					return &ErrUniqueViolation{Field: ix.field.name, Value: key, ID: id, ConflictID: other}
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package rdblite
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+)
+
+type Contactdata struct {
+	BaseTable
+	Name  string
+	Email string `rdb:"unique"`
+}
+
+func Test_unique(t *testing.T) {
+	os.Mkdir("test", 0755)
+	tt := Table[Contactdata]{}
+	defer tt.stopTimer()
+
+	a, _ := tt.Insert(Contactdata{Name: "alice", Email: "a@x.com"})
+	b, _ := tt.Insert(Contactdata{Name: "bob", Email: "b@x.com"})
+
+	_, e := tt.Insert(Contactdata{Name: "bob2", Email: "b@x.com"})
+	var ue *ErrUniqueViolation
+	if !errors.As(e, &ue) || ue.Field != "Email" || ue.ConflictID != b || ue.Value != "b@x.com" {
+		t.Error("expected unique violation got", e)
+	}
+	if e = tt.Patch(a, map[string]any{"Email": "b@x.com"}); !errors.As(e, &ue) {
+		t.Error("expected unique violation for patch got", e)
+	}
+	// updating a row with its own value is fine
+	if e = tt.Patch(a, map[string]any{"Name": "alice2"}); e != nil {
+		t.Error(e)
+	}
+	if tt.TotalRows() != 2 {
+		t.Error("expected 2 rows got", tt.TotalRows())
+	}
+
+	// transactions, swapping values is allowed
+	tx := tt.Begin()
+	_, ra := tx.FindByID(a)
+	_, rb := tx.FindByID(b)
+	ra.Email, rb.Email = rb.Email, ra.Email
+	tx.AddUpdate(ra)
+	tx.AddUpdate(rb)
+	if e = tx.Commit(); e != nil {
+		t.Error("swap failed", e)
+	}
+	// two new rows with the same value in a transaction
+	tx = tt.Begin()
+	tx.AddUpdate(Contactdata{Email: "c@x.com"})
+	tx.AddUpdate(Contactdata{Email: "c@x.com"})
+	if e = tx.Commit(); !errors.As(e, &ue) || tt.TotalRows() != 2 {
+		t.Error("expected unique violation in transaction got", e)
+	}
+	// the value of a deleted row can be used
+	tx = tt.Begin()
+	tx.Delete(a)
+	tx.AddUpdate(Contactdata{Email: "b@x.com"})
+	if e = tx.Commit(); e != nil {
+		t.Error(e)
+	}
+
+	// duplicates are reported on load
+	rows := []Contactdata{{Name: "a", Email: "same"}, {Name: "b", Email: "same"}, {Name: "c", Email: "other"}}
+	for i := range rows {
+		rows[i].ID = i + 1
+	}
+	b2, _ := json.Marshal(rows)
+	os.WriteFile("test/contacts.json", b2, 0644)
+	t2 := Table[Contactdata]{}
+	defer t2.stopTimer()
+	if e = t2.LoadJson("test/contacts.json"); !errors.As(e, &ue) || ue.ID != 2 || ue.ConflictID != 1 {
+		t.Error("expected duplicate on load got", e)
+	}
+	if t2.TotalRows() != 3 {
+		t.Error("rows should be loaded")
+	}
+
+	// CreateUniqueIndex fails on duplicates
+	t3 := Table[Testdata]{}
+	defer t3.stopTimer()
+	t3.Insert(Testdata{Name: "x"})
+	t3.Insert(Testdata{Name: "x"})
+	if e = t3.CreateUniqueIndex("Name"); !errors.As(e, &ue) {
+		t.Error("expected duplicate got", e)
+	}
+	t3.Delete(2)
+	if e = t3.CreateUniqueIndex("Name"); e != nil {
+		t.Error(e)
+	}
+	if _, e = t3.Insert(Testdata{Name: "x"}); !errors.As(e, &ue) {
+		t.Error("expected unique violation got", e)
+	}
+}
@@ -0,0 +1,100 @@
+package rdblite
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"time"
+)
+
+// UpdateFunc changes the row with the id in place under the table lock, so there is no race
+// between reading and writing the row. fn gets a copy of the row, changes to the ID are ignored
+func (t *Table[T]) UpdateFunc(id int, fn func(r *T)) error {
+	t.init()
+	start := time.Now()
+	unlock := t.writeLock(false)
+	e := t.update(id, func(r *T) error {
+		fn(r)
+		return nil
+	})
+	unlock()
+	if e != nil {
+		log.Println("update", e, time.Since(start))
+		return e
+	}
+	log.Println("update time =", time.Since(start))
+	t.autoSave()
+	return nil
+}
+
+// Patch sets the fields of the row with the id from a map of field name to value,
+// values are converted to the field type
+func (t *Table[T]) Patch(id int, values map[string]any) error {
+	t.init()
+	start := time.Now()
+	unlock := t.writeLock(false)
+	e := t.update(id, func(r *T) error {
+		return t.patch(r, values)
+	})
+	unlock()
+	if e != nil {
+		log.Println("patch", e, time.Since(start))
+		return e
+	}
+	log.Println("patch time =", time.Since(start))
+	t.autoSave()
+	return nil
+}
+
+// update callers must hold the lock
+func (t *Table[T]) update(id int, fn func(r *T) error) error {
+	found, idx := t.findIndex(id)
+	if !found {
+		return ErrNotFound
+	}
+	// copy so the stored row and indexes are unchanged if fn fails
+	r := *t.rows[idx]
+	if e := fn(&r); e != nil {
+		return e
+	}
+	setID(&r, id)
+	return t.write(&r)
+}
+
+// patch callers must hold the lock
+func (t *Table[T]) patch(r *T, values map[string]any) error {
+	for name, v := range values {
+		f, ok := t.field(name)
+		if !ok {
+			return fmt.Errorf("field %s not found", name)
+		}
+		if f.base {
+			return fmt.Errorf("field %s can not be patched", f.name)
+		}
+		var rv reflect.Value
+		if v == nil {
+			switch f.typ.Kind() {
+			case reflect.Pointer, reflect.Interface, reflect.Slice, reflect.Map:
+				rv = reflect.Zero(f.typ)
+			}
+		}
+		if !rv.IsValid() {
+			var e error
+			if rv, e = f.convert(v); e != nil {
+				return e
+			}
+		}
+		f.value(r).Set(rv)
+	}
+	return nil
+}
+
+// field by name, callers must hold the lock
+func (t *Table[T]) field(name string) (field, bool) {
+	for _, f := range t.fields {
+		if f.name == name {
+			return f, true
+		}
+	}
+	return field{}, false
+}
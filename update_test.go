@@ -0,0 +1,64 @@
+package rdblite
+
+import (
+	"testing"
+)
+
+func Test_update_patch(t *testing.T) {
+	createTest()
+	tt := Table[Testdata]{
+		GobFilename: "test/test.gob",
+	}
+	tt.LoadGob()
+	tt.CreateIndex("Age")
+	defer tt.stopTimer()
+
+	e := tt.UpdateFunc(5, func(r *Testdata) {
+		r.Name = "updated name"
+		r.Age++
+		r.ID = 1000
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+	ok, r := tt.FindByID(5)
+	if !ok || r.Name != "updated name" || r.Age != 16 || r.Version != 1 {
+		t.Error("update failed", r)
+	}
+	if ok, _ = tt.FindByID(1000); ok {
+		t.Error("ID change should be ignored")
+	}
+	if rows := tt.Search("updated name"); len(rows) != 1 {
+		t.Error("search string not regenerated", len(rows))
+	}
+	if rows, _ := tt.FindBy("Age", 16); len(rows) != 2 {
+		t.Error("index not updated", len(rows))
+	}
+
+	if e = tt.Patch(5, map[string]any{"Name": "patched", "Age": int64(40)}); e != nil {
+		t.Fatal(e)
+	}
+	if _, r = tt.FindByID(5); r.Name != "patched" || r.Age != 40 || r.Version != 2 {
+		t.Error("patch failed", r)
+	}
+
+	// errors leave the row unchanged
+	if e = tt.UpdateFunc(99_999, func(r *Testdata) {}); e != ErrNotFound {
+		t.Error("expected not found got", e)
+	}
+	if e = tt.Patch(5, map[string]any{"Name": "x", "Missing": 1}); e == nil {
+		t.Error("expected error for unknown field")
+	}
+	if e = tt.Patch(5, map[string]any{"Age": "x"}); e == nil {
+		t.Error("expected error for wrong type")
+	}
+	if e = tt.Patch(5, map[string]any{"Name": 66}); e == nil {
+		t.Error("expected error for int to string")
+	}
+	if e = tt.Patch(5, map[string]any{"ID": 7}); e == nil {
+		t.Error("expected error for ID")
+	}
+	if _, r = tt.FindByID(5); r.Name != "patched" || r.Version != 2 {
+		t.Error("failed patch changed the row", r)
+	}
+}
@@ -0,0 +1,80 @@
+package rdblite
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"time"
+	"unsafe"
+)
+
+var (
+	ErrConflict = errors.New("row version conflict")
+)
+
+// ConflictError is returned by UpdateIfVersion() when the row was changed since it was read,
+// errors.Is(e, ErrConflict) is true
+type ConflictError struct {
+	ID      int
+	Version int // version of the update
+	Current int // version in the table
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("row %d version %d is stale, current version is %d", e.ID, e.Version, e.Current)
+}
+
+func (e *ConflictError) Unwrap() error {
+	return ErrConflict
+}
+
+// UpdateIfVersion updates the row only if its Version is the version in the table,
+// so an update based on a stale read fails with a *ConflictError instead of overwriting.
+// Returns the new version
+func (t *Table[T]) UpdateIfVersion(r T) (int, error) {
+	t.init()
+	start := time.Now()
+	unlock := t.writeLock(false)
+	v, e := t.updateIfVersion(&r)
+	unlock()
+	if e != nil {
+		log.Println("update if version", e, time.Since(start))
+		return 0, e
+	}
+	log.Println("update if version time =", time.Since(start))
+	t.autoSave()
+	return v, nil
+}
+
+// updateIfVersion callers must hold the lock
+func (t *Table[T]) updateIfVersion(r *T) (int, error) {
+	id := (*r).getID()
+	found, idx := t.findIndex(id)
+	if !found {
+		return 0, ErrNotFound
+	}
+	if cur := (*t.rows[idx]).getVersion(); cur != (*r).getVersion() {
+		return 0, &ConflictError{ID: id, Version: (*r).getVersion(), Current: cur}
+	}
+	if e := t.write(r); e != nil {
+		return 0, e
+	}
+	return (*r).getVersion(), nil
+}
+
+// nextVersion sets the version of r to one more than the stored row, 1 for new rows, callers must hold the lock
+func (t *Table[T]) nextVersion(r *T) {
+	v := 1
+	if found, idx := t.findIndex((*r).getID()); found {
+		v = (*t.rows[idx]).getVersion() + 1
+	}
+	setVersion(r, v)
+}
+
+func setVersion[T any](item *T, v int) {
+	e := reflect.ValueOf(item).Elem()
+	rr := e.FieldByName("Version")
+	rr = reflect.NewAt(rr.Type(), unsafe.Pointer(rr.UnsafeAddr())).Elem()
+	rr.SetInt(int64(v))
+}
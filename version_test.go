@@ -0,0 +1,57 @@
+package rdblite
+
+import (
+	"errors"
+	"testing"
+)
+
+func Test_version(t *testing.T) {
+	createTest()
+	tt := Table[Testdata]{
+		GobFilename: "test/test.gob",
+	}
+	tt.LoadGob()
+	defer tt.stopTimer()
+
+	id := tt.AddUpdate(Testdata{Name: "new"})
+	_, r := tt.FindByID(id)
+	if r.Version != 1 {
+		t.Error("new row expected version 1 got", r.Version)
+	}
+
+	// two writers read the same version
+	_, a := tt.FindByID(id)
+	_, b := tt.FindByID(id)
+	a.Name = "a"
+	v, e := tt.UpdateIfVersion(a)
+	if e != nil || v != 2 {
+		t.Error("update failed", v, e)
+	}
+	b.Name = "b"
+	_, e = tt.UpdateIfVersion(b)
+	var ce *ConflictError
+	if !errors.Is(e, ErrConflict) || !errors.As(e, &ce) || ce.Current != 2 || ce.Version != 1 {
+		t.Error("expected conflict got", e)
+	}
+	if _, r = tt.FindByID(id); r.Name != "a" {
+		t.Error("stale update overwrote the row", r.Name)
+	}
+
+	// AddUpdate always increments
+	tt.AddUpdate(b)
+	if _, r = tt.FindByID(id); r.Version != 3 || r.Name != "b" {
+		t.Error("AddUpdate expected version 3 got", r.Version)
+	}
+
+	if _, e = tt.UpdateIfVersion(Testdata{BaseTable: BaseTable{ID: 99_999}}); e != ErrNotFound {
+		t.Error("expected not found got", e)
+	}
+
+	// transactions increment on commit
+	tx := tt.Begin()
+	tx.AddUpdate(r)
+	tx.Commit()
+	if _, r = tt.FindByID(id); r.Version != 4 {
+		t.Error("tx expected version 4 got", r.Version)
+	}
+}
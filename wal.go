@@ -0,0 +1,179 @@
+package rdblite
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/mgholam/rdblite/storagefile"
+)
+
+const (
+	walPut    = "put"
+	walDelete = "del"
+
+	walEntry = "gob" // storagefile entry type of a gob []walRecord
+)
+
+// walRecord is a change to a row, a storagefile entry holds the records applied together.
+// Records are absolute so replaying them over a newer gob file is safe
+type walRecord struct {
+	Table string // in a Database journal
+	Op    string
+	ID    int
+	Row   []byte // gob of the row like the gob file so all exported fields are kept
+}
+
+// openWAL opens the write ahead log if needed and replays it, callers must hold the lock
+func (t *Table[T]) openWAL() error {
+	if t.WALFilename == "" {
+		return nil
+	}
+	if t.wal == nil {
+		sf, e := openLog(t.WALFilename)
+		if e != nil {
+			return e
+		}
+		t.wal = sf
+	}
+	return replayLog(t.wal, t.WALFilename, t.apply)
+}
+
+// openLog opens a storagefile as a write ahead log
+func openLog(filename string) (*storagefile.StorageFile, error) {
+	// entries are written with SaveSync() so changes are on disk before AddUpdate()/Delete() return
+	return storagefile.Open(filename)
+}
+
+// replayLog calls apply for every entry in the log
+func replayLog(wal *storagefile.StorageFile, filename string, apply func(recs []walRecord) error) error {
+	count := wal.Count()
+	for i := int64(1); i <= count; i++ {
+		_, b, e := wal.Get(i)
+		if e != nil {
+			return fmt.Errorf("%s : %w", filename, e)
+		}
+		var recs []walRecord
+		if e = gob.NewDecoder(bytes.NewReader(b)).Decode(&recs); e != nil {
+			return fmt.Errorf("%s : %w", filename, e)
+		}
+		if e = apply(recs); e != nil {
+			return fmt.Errorf("%s : %w", filename, e)
+		}
+	}
+	if count > 0 {
+		log.Printf("%s : replayed %d changes\n", filename, count)
+	}
+	return nil
+}
+
+// truncateLog closes, deletes and reopens the log, an error means there is no log
+// so callers must stop writes until it is reopened
+func truncateLog(wal *storagefile.StorageFile, filename string) (*storagefile.StorageFile, error) {
+	if wal != nil {
+		wal.Close()
+	}
+	os.Remove(filename)
+	os.Remove(filename + ".idx")
+	sf, e := openLog(filename)
+	if e != nil {
+		return nil, fmt.Errorf("write ahead log %s can not be reopened : %w", filename, e)
+	}
+	return sf, nil
+}
+
+// apply logged records to the rows, callers must hold the lock
+func (t *Table[T]) apply(recs []walRecord) error {
+	for _, rec := range recs {
+		switch rec.Op {
+		case walPut:
+			r := new(T)
+			if e := gob.NewDecoder(bytes.NewReader(rec.Row)).Decode(r); e != nil {
+				return e
+			}
+			t.genstr(r)
+			t.put(r)
+		case walDelete:
+			if found, idx := t.findIndex(rec.ID); found {
+				t.remove(idx)
+			}
+		default:
+			return fmt.Errorf("unknown log record %q", rec.Op)
+		}
+	}
+	return nil
+}
+
+func putRecord[T tableInterface](r *T) (walRecord, error) {
+	var buf bytes.Buffer
+	if e := gob.NewEncoder(&buf).Encode(r); e != nil {
+		return walRecord{}, e
+	}
+	return walRecord{Op: walPut, ID: (*r).getID(), Row: buf.Bytes()}, nil
+}
+
+// logChange writes the records as one entry to the write ahead log, callers must hold the lock
+func (t *Table[T]) logChange(recs []walRecord) error {
+	if t.walErr != nil {
+		return t.walErr
+	}
+	if t.wal == nil {
+		return nil
+	}
+	for i := range recs {
+		recs[i].Table = t.name
+	}
+	return writeWAL(t.wal, recs)
+}
+
+func writeWAL(wal *storagefile.StorageFile, recs []walRecord) error {
+	if len(recs) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	if e := gob.NewEncoder(&buf).Encode(recs); e != nil {
+		return e
+	}
+	_, e := wal.SaveSync(walEntry, buf.Bytes())
+	return e
+}
+
+func (t *Table[T]) logPut(r *T) error {
+	if t.wal == nil {
+		return t.walErr
+	}
+	rec, e := putRecord(r)
+	if e != nil {
+		return e
+	}
+	return t.logChange([]walRecord{rec})
+}
+
+func (t *Table[T]) logDelete(id int) error {
+	return t.logChange([]walRecord{{Op: walDelete, ID: id}})
+}
+
+// truncateWAL empties the log after a successful save, callers must hold the lock.
+// If the log can not be reopened writes fail until a later save reopens it
+func (t *Table[T]) truncateWAL() error {
+	if t.sharedWAL || t.WALFilename == "" {
+		return nil
+	}
+	if t.walErr == nil && (t.wal == nil || t.wal.Count() == 0) {
+		return nil
+	}
+	sf, e := truncateLog(t.wal, t.WALFilename)
+	t.wal = sf
+	t.walErr = e
+	return e
+}
+
+// closeWAL callers must hold the lock
+func (t *Table[T]) closeWAL() {
+	if t.wal != nil && !t.sharedWAL {
+		t.wal.Close()
+	}
+	t.wal = nil
+}
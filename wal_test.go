@@ -0,0 +1,156 @@
+package rdblite
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func Test_wal_replay(t *testing.T) {
+	createTest()
+	os.Remove("test/test.wal")
+	os.Remove("test/test.wal.idx")
+	tt := Table[Testdata]{
+		GobFilename: "test/test.gob",
+		WALFilename: "test/test.wal",
+	}
+	if e := tt.LoadGob(); e != nil {
+		t.Fatal(e)
+	}
+	tt.Delete(5)
+	id := tt.AddUpdate(Testdata{Name: "wal row", Age: 1})
+	_, r := tt.FindByID(10)
+	r.Name = "changed"
+	tt.AddUpdate(r)
+	// crash without saving
+	tt.stopTimer()
+
+	t2 := Table[Testdata]{
+		GobFilename: "test/test.gob",
+		WALFilename: "test/test.wal",
+	}
+	if e := t2.LoadGob(); e != nil {
+		t.Fatal(e)
+	}
+	if ok, _ := t2.FindByID(5); ok {
+		t.Error("deleted row was not replayed")
+	}
+	if ok, r := t2.FindByID(id); !ok || r.Name != "wal row" {
+		t.Error("inserted row was not replayed")
+	}
+	if rows := t2.Search("changed"); len(rows) != 1 || rows[0].ID != 10 {
+		t.Error("updated row was not replayed")
+	}
+	if t2.AddUpdate(Testdata{Name: "next"}) != id+1 {
+		t.Error("lastID not restored from the log")
+	}
+
+	// a save truncates the log
+	if e := t2.Close(); e != nil {
+		t.Fatal(e)
+	}
+	t3 := Table[Testdata]{
+		GobFilename: "test/test.gob",
+		WALFilename: "test/test.wal",
+	}
+	t3.LoadGob()
+	if t3.wal.Count() != 0 {
+		t.Error("log not truncated", t3.wal.Count())
+	}
+	if t3.TotalRows() != 100 {
+		t.Error("expected 100 rows got", t3.TotalRows())
+	}
+	t3.Close()
+}
+
+type Secretdata struct {
+	BaseTable
+	Name   string
+	Secret string `json:"-"`
+}
+
+func Test_wal_gob_and_errors(t *testing.T) {
+	os.RemoveAll("test/wal")
+	os.MkdirAll("test/wal", 0755)
+	tt := Table[Secretdata]{
+		GobFilename: "test/wal/s.gob",
+		WALFilename: "test/wal/s.wal",
+	}
+	tt.SaveGob()
+	if e := tt.LoadGob(); e != nil {
+		t.Fatal(e)
+	}
+	id := tt.AddUpdate(Secretdata{Name: "a", Secret: "kept"})
+	tt.stopTimer()
+
+	t2 := Table[Secretdata]{
+		GobFilename: "test/wal/s.gob",
+		WALFilename: "test/wal/s.wal",
+	}
+	if e := t2.LoadGob(); e != nil {
+		t.Fatal(e)
+	}
+	defer t2.stopTimer()
+	if _, r := t2.FindByID(id); r.Secret != "kept" {
+		t.Error("json:\"-\" field lost on replay", r)
+	}
+
+	// the log can not be reopened after a save so writes fail
+	os.Remove("test/wal/s.wal")
+	os.Remove("test/wal/s.wal.idx")
+	os.MkdirAll("test/wal/s.wal/x", 0755)
+	t2.AddUpdate(Secretdata{Name: "b"})
+	if e := t2.SaveGob(); e == nil {
+		t.Error("expected reopen error")
+	}
+	if id := t2.AddUpdate(Secretdata{Name: "c"}); id != 0 {
+		t.Error("write without a log should fail")
+	}
+	if _, e := t2.Insert(Secretdata{Name: "c"}); e == nil {
+		t.Error("expected error from insert")
+	}
+	// the next save reopens it
+	os.RemoveAll("test/wal/s.wal")
+	if e := t2.SaveGob(); e != nil {
+		t.Fatal(e)
+	}
+	if id := t2.AddUpdate(Secretdata{Name: "d"}); id == 0 || t2.wal.Count() != 1 {
+		t.Error("write after reopen failed")
+	}
+	t2.Close()
+}
+
+func Test_wal_large_entry(t *testing.T) {
+	os.RemoveAll("test/walbig")
+	os.MkdirAll("test/walbig", 0755)
+	tt := Table[Testdata]{
+		GobFilename: "test/walbig/big.gob",
+		WALFilename: "test/walbig/big.wal",
+	}
+	tt.SaveGob()
+	if e := tt.LoadGob(); e != nil {
+		t.Fatal(e)
+	}
+	// one entry over 32 KB
+	tx := tt.Begin()
+	for i := 0; i < 20; i++ {
+		tx.AddUpdate(Testdata{Name: strings.Repeat("x", 2048)})
+	}
+	if e := tx.Commit(); e != nil {
+		t.Fatal(e)
+	}
+	// crash without closing so the index is rebuilt on open
+	tt.stopTimer()
+
+	t2 := Table[Testdata]{
+		GobFilename: "test/walbig/big.gob",
+		WALFilename: "test/walbig/big.wal",
+	}
+	if e := t2.LoadGob(); e != nil {
+		t.Fatal(e)
+	}
+	if t2.TotalRows() != 20 {
+		t.Error("large entry not replayed", t2.TotalRows())
+	}
+	t2.Close()
+}